@@ -1,16 +1,24 @@
 package application
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
 	"github.com/sirupsen/logrus"
 	logger "go-network/logrus"
+	"go-network/network"
 	"go-network/pattern"
 	"go-network/utils"
+	"net"
+	"net/http"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
+const defaultMetricsPath = "/metrics"
+
 var defaultCommands map[string]bool = map[string]bool{
 	"quit": true,
 }
@@ -40,17 +48,28 @@ type CustomLogSettings struct {
 	Options []rotatelogs.Option
 }
 
+type MetricsSettings struct {
+	Enable bool
+	Address string
+	Path string
+}
+
 type AppSettings struct {
 	AppLogSettings AppLogSettings
 	CustomLogSettings CustomLogSettings
+	MetricsSettings MetricsSettings
 }
 
 type Application struct {
 	rootPath string
 	stop chan struct{}
 	commands map[string]CommandFunc
+	startTime time.Time
+	executedCommands uint64
+	metricsServer *http.Server
 	DefaultLogger *logger.Logger
 	Logger *logger.Logger
+	Metrics *network.Metrics
 }
 
 func (app *Application) Init(settings AppSettings) bool {
@@ -58,6 +77,11 @@ func (app *Application) Init(settings AppSettings) bool {
 	app.initAppLogger(settings.AppLogSettings)
 	app.initCustomLogger(settings.CustomLogSettings)
 	app.addDefaultCommands()
+
+	if !app.initMetrics(settings.MetricsSettings) {
+		return false
+	}
+
 	app.Debug("Application::Init: Initialized success.")
 
 	return true
@@ -89,6 +113,58 @@ func (app *Application) initCustomLogger(settings CustomLogSettings) {
 	}, settings.Options...)
 }
 
+func (app *Application) initMetrics(settings MetricsSettings) bool {
+	app.startTime = time.Now()
+	app.Metrics = network.NewMetrics()
+	app.Metrics.RegisterGauge("go_network_app_uptime_seconds", "Seconds since the application started.",
+		func() float64 {
+			return time.Since(app.startTime).Seconds()
+		})
+	app.Metrics.RegisterCounter("go_network_app_executed_commands_total", "Console commands executed.",
+		func() float64 {
+			return float64(atomic.LoadUint64(&app.executedCommands))
+		})
+
+	if !settings.Enable {
+		return true
+	}
+
+	path := settings.Path
+
+	if path == "" {
+		path = defaultMetricsPath
+	}
+
+	listener, err := net.Listen("tcp", settings.Address)
+
+	if err != nil {
+		app.Error("Application::initMetrics: ", err)
+		return false
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, app.Metrics)
+	app.metricsServer = &http.Server{
+		Handler: mux,
+	}
+
+	go app.metricsServer.Serve(listener)
+	app.Debug("Application::initMetrics: Serving metrics on ", listener.Addr().String(), path)
+
+	return true
+}
+
+func (app *Application) stopMetrics() {
+	if app.metricsServer == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	app.metricsServer.Shutdown(ctx)
+}
+
 func (app *Application) Run() {
 	app.DefaultLogger.Debug("Application::Run: App was started.")
 
@@ -118,6 +194,7 @@ func (app *Application) executeCommand(str string) {
 		return
 	}
 
+	atomic.AddUint64(&app.executedCommands, 1)
 	cmdFunc(paramParts[1:])
 }
 
@@ -150,9 +227,14 @@ func (app *Application) addDefaultCommands() {
 }
 
 func (app *Application) onQuit([]string) {
+	app.stopMetrics()
 	close(app.stop)
 }
 
+func (app *Application) GetMetrics() *network.Metrics {
+	return app.Metrics
+}
+
 func (app *Application) GetRootPath() string {
 	return app.rootPath
 }
@@ -165,6 +247,14 @@ func (app *Application) Debug(args ...interface{}) {
 	app.DefaultLogger.Debug(args...)
 }
 
+func (app *Application) Error(args ...interface{}) {
+	if app.DefaultLogger == nil {
+		return
+	}
+
+	app.DefaultLogger.Error(args...)
+}
+
 var instance = pattern.NewSingleton(pattern.SingletonSettings{
 	OnInit: func() (interface{}, bool) {
 		return &Application{
@@ -1,37 +1,91 @@
 package network
 
 import (
+	"context"
+	"crypto/tls"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+const defaultHandshakeTimeout = time.Second * 10
+
 type acceptorListenFunc func(acceptor *Acceptor)
 type acceptorNewSessionFunc func(acceptor *Acceptor, session *Session)
 type acceptorErrorFunc func(acceptor *Acceptor, err error)
+type acceptorRejectFunc func(acceptor *Acceptor, remoteAddr net.Addr, reason RejectReason)
+type acceptorAcceptFunc func(remoteAddr net.Addr) bool
 
 type AcceptorSettings struct {
 	OnListen     acceptorListenFunc
 	OnNewSession acceptorNewSessionFunc
 	OnError      acceptorErrorFunc
+	OnReject     acceptorRejectFunc
+	OnAccept     acceptorAcceptFunc
 
 	SessionSettings SessionSettings
+	TLSConfig *tls.Config
+	HandshakeTimeout time.Duration
+	MaxSessions int
+	MaxSessionsPerIP int
+	AcceptRate float64
+	AcceptBurst int
+	AllowList []string
+	DenyList []string
+	Transport Transport
+	ReliableUDP ReliableUDPSettings
 }
 
 type Acceptor struct {
+	stats acceptorCounters
 	stop chan struct{}
+	stopOnce sync.Once
+	acceptDone chan struct{}
 	listener net.Listener
+	sessions *sessionManager
+	handshakes sync.WaitGroup
 
 	onListen     acceptorListenFunc
 	onNewSession acceptorNewSessionFunc
 	onError      acceptorErrorFunc
+	onReject     acceptorRejectFunc
+	onAccept     acceptorAcceptFunc
 
+	settingsErr error
+	filter *ipFilter
+	limiter *connectionLimiter
 	sessionSettings SessionSettings
+	tlsConfig *tls.Config
+	handshakeTimeout time.Duration
+	transport Transport
+	reliableUDP ReliableUDPSettings
+	metricsMutex sync.Mutex
+	metrics *Metrics
 }
 
 func (acceptor *Acceptor) SetAcceptorSettings(settings AcceptorSettings) {
 	acceptor.onListen = settings.OnListen
 	acceptor.onNewSession = settings.OnNewSession
 	acceptor.onError = settings.OnError
+	acceptor.onReject = settings.OnReject
+	acceptor.onAccept = settings.OnAccept
+	acceptor.limiter.configure(settings.MaxSessions, settings.MaxSessionsPerIP,
+		settings.AcceptRate, settings.AcceptBurst)
 	acceptor.sessionSettings = settings.SessionSettings
+	acceptor.tlsConfig = settings.TLSConfig
+	acceptor.handshakeTimeout = settings.HandshakeTimeout
+	acceptor.transport = settings.Transport
+	acceptor.reliableUDP = settings.ReliableUDP
+	acceptor.settingsErr = validateFramer(settings.SessionSettings.Framer)
+
+	if acceptor.settingsErr == nil {
+		acceptor.settingsErr = acceptor.SetAllowList(settings.AllowList)
+	}
+
+	if acceptor.settingsErr == nil {
+		acceptor.settingsErr = acceptor.SetDenyList(settings.DenyList)
+	}
 
 	if acceptor.onListen == nil {
 		acceptor.onListen = func(acceptor *Acceptor) {
@@ -47,24 +101,86 @@ func (acceptor *Acceptor) SetAcceptorSettings(settings AcceptorSettings) {
 		acceptor.onError = func(acceptor *Acceptor, err error) {
 		}
 	}
+
+	if acceptor.onReject == nil {
+		acceptor.onReject = func(acceptor *Acceptor, remoteAddr net.Addr, reason RejectReason) {
+		}
+	}
+
+	if acceptor.onAccept == nil {
+		acceptor.onAccept = func(remoteAddr net.Addr) bool {
+			return true
+		}
+	}
+
+	if acceptor.handshakeTimeout <= 0 {
+		acceptor.handshakeTimeout = defaultHandshakeTimeout
+	}
 }
 
+// Start listens on host and port. An empty host or "::" listens dual-stack
+// on both IPv4 and IPv6 where the platform supports it; use Listen with
+// "tcp4" or "tcp6" to restrict the address family.
 func (acceptor *Acceptor) Start(host string, port int) bool {
 	address := ComposeAddressByHostAndPort(host, port)
-	listener, err := net.Listen("tcp", address)
+
+	if acceptor.transport == TransportReliableUDP {
+		return acceptor.Listen("udp", address)
+	}
+
+	return acceptor.Listen("tcp", address)
+}
+
+// Listen listens on any stream network understood by net.Listen, such as
+// "tcp6" or "unix", and serves it in the background. With
+// TransportReliableUDP the network must be "udp", "udp4" or "udp6".
+func (acceptor *Acceptor) Listen(network string, address string) bool {
+	if acceptor.settingsErr != nil {
+		acceptor.onError(acceptor, acceptor.settingsErr)
+		return false
+	}
+
+	var listener net.Listener
+	var err error
+
+	if acceptor.transport == TransportReliableUDP {
+		listener, err = ListenReliableUDP(network, address, acceptor.reliableUDP)
+	} else {
+		listener, err = net.Listen(network, address)
+	}
 
 	if err != nil {
 		acceptor.onError(acceptor, err)
 		return false
 	}
 
+	return acceptor.Serve(listener)
+}
+
+// Serve accepts connections from an existing listener in the background. The
+// acceptor takes ownership of the listener and closes it on Stop.
+func (acceptor *Acceptor) Serve(listener net.Listener) bool {
+	if acceptor.settingsErr != nil {
+		acceptor.onError(acceptor, acceptor.settingsErr)
+		listener.Close()
+		return false
+	}
+
+	if acceptor.tlsConfig != nil {
+		listener = tls.NewListener(listener, acceptor.tlsConfig)
+	}
+
 	acceptor.listener = listener
 	go acceptor.doAccept()
+	acceptor.onListen(acceptor)
 
 	return true
 }
 
 func (acceptor *Acceptor) doAccept() {
+	defer close(acceptor.acceptDone)
+	defer acceptor.handshakes.Wait()
+
 	for {
 		select {
 		case <-acceptor.stop:
@@ -73,27 +189,219 @@ func (acceptor *Acceptor) doAccept() {
 			conn, err := acceptor.listener.Accept()
 
 			if err != nil {
-				acceptor.onError(acceptor, err)
+				if !acceptor.isStopped() {
+					acceptor.onError(acceptor, err)
+				}
+
 				acceptor.listener.Close()
 				return
 			}
 
-			socket := NewSocket(conn)
-			session := NewSession(acceptor.sessionSettings, socket)
-			acceptor.onNewSession(acceptor, session)
-			session.Start()
+			if !acceptor.filter.permits(addrIP(conn.RemoteAddr())) {
+				acceptor.reject(conn, RejectDenied)
+				continue
+			}
+
+			if !acceptor.onAccept(conn.RemoteAddr()) {
+				acceptor.reject(conn, RejectFiltered)
+				continue
+			}
+
+			reason, ok := acceptor.limiter.admit(remoteIP(conn.RemoteAddr()))
+
+			if !ok {
+				acceptor.reject(conn, reason)
+				continue
+			}
+
+			tlsConn, ok := conn.(*tls.Conn)
+
+			if !ok {
+				acceptor.newSession(conn)
+				continue
+			}
+
+			acceptor.handshakes.Add(1)
+			go acceptor.doHandshake(tlsConn)
 		}
 	}
 }
 
+func (acceptor *Acceptor) doHandshake(conn *tls.Conn) {
+	defer acceptor.handshakes.Done()
+
+	conn.SetDeadline(time.Now().Add(acceptor.handshakeTimeout))
+	err := conn.Handshake()
+
+	if err != nil {
+		acceptor.limiter.release(remoteIP(conn.RemoteAddr()))
+
+		if !acceptor.isStopped() {
+			acceptor.onError(acceptor, err)
+		}
+
+		acceptor.reject(conn, RejectHandshakeFailed)
+		return
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	if acceptor.isStopped() {
+		acceptor.limiter.release(remoteIP(conn.RemoteAddr()))
+		conn.Close()
+		return
+	}
+
+	acceptor.newSession(conn)
+}
+
+func (acceptor *Acceptor) reject(conn net.Conn, reason RejectReason) {
+	atomic.AddUint64(&acceptor.stats.rejected, 1)
+	conn.Close()
+	acceptor.onReject(acceptor, conn.RemoteAddr(), reason)
+}
+
+func (acceptor *Acceptor) newSession(conn net.Conn) {
+	session := NewSessionFromConn(acceptor.sessionSettings, conn)
+	session.stats.parent = &acceptor.stats.trafficCounters
+	session.metrics = acceptor.getMetrics()
+	atomic.AddUint64(&acceptor.stats.accepted, 1)
+	session.addDisconnectHook(acceptor.sessions.remove)
+	session.addDisconnectHook(func(session *Session) {
+		acceptor.limiter.release(remoteIP(conn.RemoteAddr()))
+	})
+	acceptor.sessions.add(session)
+	acceptor.onNewSession(acceptor, session)
+	session.Start()
+}
+
 func (acceptor *Acceptor) Stop() {
-	close(acceptor.stop)
-	acceptor.listener.Close()
+	acceptor.stopListening()
+	acceptor.sessions.closeAll()
+}
+
+func (acceptor *Acceptor) Shutdown(ctx context.Context) error {
+	acceptor.stopListening()
+
+	if acceptor.listener != nil {
+		select {
+		case <-acceptor.acceptDone:
+		case <-ctx.Done():
+			acceptor.sessions.closeAll()
+			return ctx.Err()
+		}
+	}
+
+	sessions := acceptor.sessions.list()
+	deadline, _ := ctx.Deadline()
+
+	for _, session := range sessions {
+		session.closeWithDeadline(ErrAcceptorShutdown, deadline)
+	}
+
+	for _, session := range sessions {
+		select {
+		case <-session.Done():
+		case <-ctx.Done():
+			acceptor.sessions.closeAll()
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (acceptor *Acceptor) stopListening() {
+	acceptor.stopOnce.Do(func() {
+		close(acceptor.stop)
+
+		if acceptor.listener != nil {
+			acceptor.listener.Close()
+		}
+	})
+}
+
+func (acceptor *Acceptor) setMetrics(metrics *Metrics) {
+	acceptor.metricsMutex.Lock()
+	defer acceptor.metricsMutex.Unlock()
+
+	acceptor.metrics = metrics
+}
+
+func (acceptor *Acceptor) getMetrics() *Metrics {
+	acceptor.metricsMutex.Lock()
+	defer acceptor.metricsMutex.Unlock()
+
+	return acceptor.metrics
+}
+
+func (acceptor *Acceptor) isStopped() bool {
+	select {
+	case <-acceptor.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetAllowList replaces the CIDR allow list. Bare IP addresses are accepted
+// as single-host networks. An empty list allows every address that is not
+// denied. Peers without an IP address, such as Unix socket clients, are
+// rejected while an allow list is set. It is safe to call while the acceptor
+// is running.
+func (acceptor *Acceptor) SetAllowList(cidrs []string) error {
+	return acceptor.filter.setAllowList(cidrs)
+}
+
+// SetDenyList replaces the CIDR deny list, which takes precedence over the
+// allow list. It is safe to call while the acceptor is running.
+func (acceptor *Acceptor) SetDenyList(cidrs []string) error {
+	return acceptor.filter.setDenyList(cidrs)
+}
+
+func (acceptor *Acceptor) Sessions() []*Session {
+	return acceptor.sessions.list()
+}
+
+func (acceptor *Acceptor) Get(id uint64) (*Session, bool) {
+	return acceptor.sessions.get(id)
+}
+
+func (acceptor *Acceptor) Count() int {
+	return acceptor.sessions.count()
+}
+
+// Broadcast queues data for every session without blocking and returns the
+// sessions whose send queue could not take it.
+func (acceptor *Acceptor) Broadcast(data []byte) []*Session {
+	return acceptor.sessions.broadcast(data, nil)
+}
+
+func (acceptor *Acceptor) BroadcastExcept(data []byte, except ...*Session) []*Session {
+	ids := make(map[uint64]bool, len(except))
+
+	for _, session := range except {
+		ids[session.GetID()] = true
+	}
+
+	return acceptor.sessions.broadcast(data, ids)
+}
+
+func (acceptor *Acceptor) Stats() AcceptorStats {
+	return acceptor.stats.snapshot(acceptor.sessions.count())
+}
+
+func (acceptor *Acceptor) CloseAll() {
+	acceptor.sessions.closeAll()
 }
 
 func NewAcceptor(settings AcceptorSettings) *Acceptor {
 	acceptor := &Acceptor{
 		stop: make(chan struct{}),
+		acceptDone: make(chan struct{}),
+		sessions: newSessionManager(),
+		filter: newIPFilter(),
+		limiter: newConnectionLimiter(),
 	}
 
 	acceptor.SetAcceptorSettings(settings)
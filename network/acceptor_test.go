@@ -0,0 +1,31 @@
+package network
+
+import (
+	"net"
+	"testing"
+)
+
+func TestServeFiresOnListen(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listened := 0
+	acceptor := NewAcceptor(AcceptorSettings{
+		OnListen: func(acceptor *Acceptor) {
+			listened++
+		},
+	})
+
+	if !acceptor.Serve(listener) {
+		t.Fatal("Serve failed")
+	}
+
+	defer acceptor.Stop()
+
+	if listened != 1 {
+		t.Fatalf("OnListen fired %d times, want 1", listened)
+	}
+}
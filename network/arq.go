@@ -0,0 +1,669 @@
+package network
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const (
+	arqCmdPush uint8 = iota + 1
+	arqCmdAck
+	arqCmdProbe
+	arqCmdWindow
+	arqCmdFin
+)
+
+const (
+	arqHeaderSize      = 21
+	arqMaxRTO          = 60000
+	arqMaxBackoff      = 5000
+	arqMinSSThresh     = 2
+	arqProbeInitial    = 1000
+	arqProbeLimit      = 10000
+	arqInitialRTO      = 200
+	arqInitialSSThresh = 16
+)
+
+var arqEpoch = time.Now()
+
+func arqNow() uint32 {
+	return uint32(time.Since(arqEpoch) / time.Millisecond)
+}
+
+func timeDiff(later uint32, earlier uint32) int32 {
+	return int32(later - earlier)
+}
+
+type arqSegment struct {
+	conv uint32
+	cmd  uint8
+	wnd  uint16
+	ts   uint32
+	sn   uint32
+	una  uint32
+	data []byte
+
+	resendTs uint32
+	rto      uint32
+	fastAck  uint32
+	xmit     uint32
+}
+
+func (segment *arqSegment) encode(buffer []byte) []byte {
+	var header [arqHeaderSize]byte
+
+	binary.LittleEndian.PutUint32(header[0:], segment.conv)
+	header[4] = segment.cmd
+	binary.LittleEndian.PutUint16(header[5:], segment.wnd)
+	binary.LittleEndian.PutUint32(header[7:], segment.ts)
+	binary.LittleEndian.PutUint32(header[11:], segment.sn)
+	binary.LittleEndian.PutUint32(header[15:], segment.una)
+	binary.LittleEndian.PutUint16(header[19:], uint16(len(segment.data)))
+
+	buffer = append(buffer, header[:]...)
+
+	return append(buffer, segment.data...)
+}
+
+type arqAck struct {
+	sn uint32
+	ts uint32
+}
+
+// arq implements the KCP-style automatic repeat request state machine used by
+// reliable UDP connections: sequence numbers, cumulative and selective
+// acknowledgements, fast retransmission, RTT estimation, flow control and
+// congestion control. It performs no I/O and is not safe for concurrent use.
+type arq struct {
+	conv   uint32
+	mtu    int
+	mss    int
+	output func(datagram []byte)
+
+	sndUna uint32
+	sndNxt uint32
+	rcvNxt uint32
+
+	ssthresh uint32
+	cwnd     uint32
+	incr     uint32
+
+	rxSrtt   int32
+	rxRttvar int32
+	rxRto    uint32
+	rxMinRto uint32
+
+	sndWnd uint32
+	rcvWnd uint32
+	rmtWnd uint32
+
+	interval   uint32
+	fastResend uint32
+	noCwnd     bool
+	deadLink   uint32
+	dead       bool
+
+	probeAsk  bool
+	probeTell bool
+	probeTs   uint32
+	probeWait uint32
+
+	sndQueue  []*arqSegment
+	sndBuf    []*arqSegment
+	rcvBuf    []*arqSegment
+	rcvQueue  []*arqSegment
+	rcvOffset int
+	eof       bool
+	ackList   []arqAck
+	buffer    []byte
+}
+
+func (arq *arq) waitSnd() int {
+	return len(arq.sndBuf) + len(arq.sndQueue)
+}
+
+func (arq *arq) send(data []byte) {
+	for len(data) > 0 {
+		count := len(arq.sndQueue)
+
+		if count > 0 {
+			last := arq.sndQueue[count-1]
+
+			if last.cmd == arqCmdPush && len(last.data) < arq.mss {
+				size := arq.mss - len(last.data)
+
+				if size > len(data) {
+					size = len(data)
+				}
+
+				last.data = append(last.data, data[:size]...)
+				data = data[size:]
+				continue
+			}
+		}
+
+		size := arq.mss
+
+		if size > len(data) {
+			size = len(data)
+		}
+
+		segment := &arqSegment{
+			cmd:  arqCmdPush,
+			data: make([]byte, size, arq.mss),
+		}
+
+		copy(segment.data, data)
+		arq.sndQueue = append(arq.sndQueue, segment)
+		data = data[size:]
+	}
+}
+
+// sendControl queues an empty, reliably delivered segment. An empty push
+// opens the connection and a fin marks the end of the stream.
+func (arq *arq) sendControl(cmd uint8) {
+	arq.sndQueue = append(arq.sndQueue, &arqSegment{cmd: cmd})
+}
+
+// recv copies buffered stream data into data. It reports io.EOF semantics
+// through eof once the peer's fin has been reached.
+func (arq *arq) recv(data []byte) (int, bool) {
+	wasFull := len(arq.rcvQueue) >= int(arq.rcvWnd)
+	size := 0
+
+	for len(arq.rcvQueue) > 0 && size < len(data) {
+		segment := arq.rcvQueue[0]
+
+		if segment.cmd == arqCmdFin {
+			arq.eof = true
+			break
+		}
+
+		copied := copy(data[size:], segment.data[arq.rcvOffset:])
+		size += copied
+		arq.rcvOffset += copied
+
+		if arq.rcvOffset < len(segment.data) {
+			break
+		}
+
+		arq.rcvQueue[0] = nil
+		arq.rcvQueue = arq.rcvQueue[1:]
+		arq.rcvOffset = 0
+	}
+
+	if size == 0 && len(arq.rcvQueue) > 0 && arq.rcvQueue[0].cmd == arqCmdFin {
+		arq.eof = true
+	}
+
+	arq.moveReceived()
+
+	if wasFull && len(arq.rcvQueue) < int(arq.rcvWnd) {
+		arq.probeTell = true
+	}
+
+	return size, arq.eof && size == 0
+}
+
+func (arq *arq) moveReceived() {
+	for len(arq.rcvBuf) > 0 && len(arq.rcvQueue) < int(arq.rcvWnd) {
+		segment := arq.rcvBuf[0]
+
+		if segment.sn != arq.rcvNxt {
+			break
+		}
+
+		arq.rcvBuf[0] = nil
+		arq.rcvBuf = arq.rcvBuf[1:]
+		arq.rcvNxt++
+
+		if segment.cmd == arqCmdPush && len(segment.data) == 0 {
+			continue
+		}
+
+		arq.rcvQueue = append(arq.rcvQueue, segment)
+	}
+}
+
+func (arq *arq) wndUnused() uint16 {
+	if len(arq.rcvQueue) < int(arq.rcvWnd) {
+		return uint16(int(arq.rcvWnd) - len(arq.rcvQueue))
+	}
+
+	return 0
+}
+
+func (arq *arq) updateRTT(rtt int32) {
+	if arq.rxSrtt == 0 {
+		arq.rxSrtt = rtt
+		arq.rxRttvar = rtt / 2
+	} else {
+		delta := rtt - arq.rxSrtt
+
+		if delta < 0 {
+			delta = -delta
+		}
+
+		arq.rxRttvar = (3*arq.rxRttvar + delta) / 4
+		arq.rxSrtt = (7*arq.rxSrtt + rtt) / 8
+
+		if arq.rxSrtt < 1 {
+			arq.rxSrtt = 1
+		}
+	}
+
+	variance := uint32(4 * arq.rxRttvar)
+
+	if variance < arq.interval {
+		variance = arq.interval
+	}
+
+	rto := uint32(arq.rxSrtt) + variance
+
+	if rto < arq.rxMinRto {
+		rto = arq.rxMinRto
+	}
+
+	if rto > arqMaxRTO {
+		rto = arqMaxRTO
+	}
+
+	arq.rxRto = rto
+}
+
+func (arq *arq) shrinkBuf() {
+	if len(arq.sndBuf) > 0 {
+		arq.sndUna = arq.sndBuf[0].sn
+		return
+	}
+
+	arq.sndUna = arq.sndNxt
+}
+
+func (arq *arq) parseAck(sn uint32) {
+	if timeDiff(sn, arq.sndUna) < 0 || timeDiff(sn, arq.sndNxt) >= 0 {
+		return
+	}
+
+	for i, segment := range arq.sndBuf {
+		if segment.sn == sn {
+			arq.sndBuf = append(arq.sndBuf[:i], arq.sndBuf[i+1:]...)
+			return
+		}
+
+		if timeDiff(sn, segment.sn) < 0 {
+			return
+		}
+	}
+}
+
+func (arq *arq) parseUna(una uint32) {
+	count := 0
+
+	for _, segment := range arq.sndBuf {
+		if timeDiff(una, segment.sn) <= 0 {
+			break
+		}
+
+		count++
+	}
+
+	if count > 0 {
+		arq.sndBuf = arq.sndBuf[count:]
+	}
+}
+
+func (arq *arq) parseFastAck(sn uint32, ts uint32) {
+	if timeDiff(sn, arq.sndUna) < 0 || timeDiff(sn, arq.sndNxt) >= 0 {
+		return
+	}
+
+	for _, segment := range arq.sndBuf {
+		if timeDiff(sn, segment.sn) <= 0 {
+			break
+		}
+
+		if timeDiff(ts, segment.ts) >= 0 {
+			segment.fastAck++
+		}
+	}
+}
+
+func (arq *arq) parseData(segment *arqSegment) {
+	sn := segment.sn
+
+	if timeDiff(sn, arq.rcvNxt+arq.rcvWnd) >= 0 || timeDiff(sn, arq.rcvNxt) < 0 {
+		return
+	}
+
+	index := len(arq.rcvBuf)
+
+	for index > 0 {
+		previous := arq.rcvBuf[index-1]
+
+		if previous.sn == sn {
+			return
+		}
+
+		if timeDiff(sn, previous.sn) > 0 {
+			break
+		}
+
+		index--
+	}
+
+	arq.rcvBuf = append(arq.rcvBuf, nil)
+	copy(arq.rcvBuf[index+1:], arq.rcvBuf[index:])
+	arq.rcvBuf[index] = segment
+	arq.moveReceived()
+}
+
+// input processes one datagram from the peer and reports whether any of its
+// segments belonged to this connection.
+func (arq *arq) input(datagram []byte) bool {
+	previousUna := arq.sndUna
+	maxAck := uint32(0)
+	maxAckTs := uint32(0)
+	hasAck := false
+	accepted := false
+
+	for len(datagram) >= arqHeaderSize {
+		conv := binary.LittleEndian.Uint32(datagram[0:])
+		cmd := datagram[4]
+		wnd := binary.LittleEndian.Uint16(datagram[5:])
+		ts := binary.LittleEndian.Uint32(datagram[7:])
+		sn := binary.LittleEndian.Uint32(datagram[11:])
+		una := binary.LittleEndian.Uint32(datagram[15:])
+		size := int(binary.LittleEndian.Uint16(datagram[19:]))
+		datagram = datagram[arqHeaderSize:]
+
+		if conv != arq.conv || size > len(datagram) || cmd < arqCmdPush || cmd > arqCmdFin {
+			break
+		}
+
+		accepted = true
+		arq.rmtWnd = uint32(wnd)
+		arq.parseUna(una)
+		arq.shrinkBuf()
+
+		switch cmd {
+		case arqCmdAck:
+			rtt := timeDiff(arqNow(), ts)
+
+			if rtt >= 0 {
+				arq.updateRTT(rtt)
+			}
+
+			arq.parseAck(sn)
+			arq.shrinkBuf()
+
+			if !hasAck || timeDiff(sn, maxAck) > 0 {
+				hasAck = true
+				maxAck = sn
+				maxAckTs = ts
+			}
+		case arqCmdPush, arqCmdFin:
+			if timeDiff(sn, arq.rcvNxt+arq.rcvWnd) < 0 {
+				arq.ackList = append(arq.ackList, arqAck{sn: sn, ts: ts})
+
+				if timeDiff(sn, arq.rcvNxt) >= 0 {
+					segment := &arqSegment{
+						conv: conv,
+						cmd:  cmd,
+						sn:   sn,
+						data: append([]byte(nil), datagram[:size]...),
+					}
+
+					arq.parseData(segment)
+				}
+			}
+		case arqCmdProbe:
+			arq.probeTell = true
+		}
+
+		datagram = datagram[size:]
+	}
+
+	if hasAck {
+		arq.parseFastAck(maxAck, maxAckTs)
+	}
+
+	if timeDiff(arq.sndUna, previousUna) > 0 {
+		arq.growWindow()
+	}
+
+	return accepted
+}
+
+func (arq *arq) growWindow() {
+	mss := uint32(arq.mss)
+
+	if arq.cwnd >= arq.rmtWnd {
+		return
+	}
+
+	if arq.cwnd < arq.ssthresh {
+		arq.cwnd++
+		arq.incr += mss
+	} else {
+		if arq.incr < mss {
+			arq.incr = mss
+		}
+
+		arq.incr += (mss*mss)/arq.incr + mss/16
+
+		if (arq.cwnd+1)*mss <= arq.incr {
+			arq.cwnd++
+		}
+	}
+
+	if arq.cwnd > arq.rmtWnd {
+		arq.cwnd = arq.rmtWnd
+		arq.incr = arq.rmtWnd * mss
+	}
+}
+
+func (arq *arq) emit(segment *arqSegment) {
+	if len(arq.buffer)+arqHeaderSize+len(segment.data) > arq.mtu {
+		arq.flushBuffer()
+	}
+
+	arq.buffer = segment.encode(arq.buffer)
+}
+
+func (arq *arq) flushBuffer() {
+	if len(arq.buffer) == 0 {
+		return
+	}
+
+	arq.output(arq.buffer)
+	arq.buffer = arq.buffer[:0]
+}
+
+// flush sends pending acknowledgements, window probes, new segments that fit
+// the window and any retransmissions that are due.
+func (arq *arq) flush() {
+	current := arqNow()
+	control := arqSegment{
+		conv: arq.conv,
+		cmd:  arqCmdAck,
+		wnd:  arq.wndUnused(),
+		una:  arq.rcvNxt,
+	}
+
+	for _, ack := range arq.ackList {
+		control.sn = ack.sn
+		control.ts = ack.ts
+		arq.emit(&control)
+	}
+
+	arq.ackList = arq.ackList[:0]
+	arq.updateProbe(current)
+
+	if arq.probeAsk {
+		control.cmd = arqCmdProbe
+		control.sn = 0
+		control.ts = current
+		arq.emit(&control)
+	}
+
+	if arq.probeTell {
+		control.cmd = arqCmdWindow
+		control.sn = 0
+		control.ts = current
+		arq.emit(&control)
+	}
+
+	arq.probeAsk = false
+	arq.probeTell = false
+
+	cwnd := arq.sndWnd
+
+	if arq.rmtWnd < cwnd {
+		cwnd = arq.rmtWnd
+	}
+
+	if !arq.noCwnd && arq.cwnd < cwnd {
+		cwnd = arq.cwnd
+	}
+
+	for len(arq.sndQueue) > 0 && timeDiff(arq.sndNxt, arq.sndUna+cwnd) < 0 {
+		segment := arq.sndQueue[0]
+		arq.sndQueue[0] = nil
+		arq.sndQueue = arq.sndQueue[1:]
+
+		segment.conv = arq.conv
+		segment.sn = arq.sndNxt
+		segment.resendTs = current
+		segment.rto = arq.rxRto
+		arq.sndNxt++
+		arq.sndBuf = append(arq.sndBuf, segment)
+	}
+
+	resent := arq.fastResend
+
+	if resent == 0 {
+		resent = ^uint32(0)
+	}
+
+	fastRetransmitted := false
+	lost := false
+
+	for _, segment := range arq.sndBuf {
+		send := false
+
+		if segment.xmit == 0 {
+			send = true
+			segment.rto = arq.rxRto
+			segment.resendTs = current + segment.rto
+		} else if timeDiff(current, segment.resendTs) >= 0 {
+			send = true
+			lost = true
+			segment.rto += segment.rto
+
+			if segment.rto > arqMaxBackoff {
+				segment.rto = arqMaxBackoff
+			}
+
+			segment.resendTs = current + segment.rto
+		} else if segment.fastAck >= resent {
+			send = true
+			fastRetransmitted = true
+			segment.fastAck = 0
+			segment.resendTs = current + segment.rto
+		}
+
+		if !send {
+			continue
+		}
+
+		segment.xmit++
+		segment.ts = current
+		segment.wnd = control.wnd
+		segment.una = arq.rcvNxt
+		arq.emit(segment)
+
+		if segment.xmit >= arq.deadLink {
+			arq.dead = true
+		}
+	}
+
+	arq.flushBuffer()
+
+	if fastRetransmitted {
+		inflight := arq.sndNxt - arq.sndUna
+		arq.ssthresh = inflight / 2
+
+		if arq.ssthresh < arqMinSSThresh {
+			arq.ssthresh = arqMinSSThresh
+		}
+
+		arq.cwnd = arq.ssthresh + resent
+		arq.incr = arq.cwnd * uint32(arq.mss)
+	}
+
+	if lost {
+		arq.ssthresh = arq.cwnd / 2
+
+		if arq.ssthresh < arqMinSSThresh {
+			arq.ssthresh = arqMinSSThresh
+		}
+
+		arq.cwnd = 1
+		arq.incr = uint32(arq.mss)
+	}
+
+	if arq.cwnd < 1 {
+		arq.cwnd = 1
+		arq.incr = uint32(arq.mss)
+	}
+}
+
+func (arq *arq) updateProbe(current uint32) {
+	if arq.rmtWnd != 0 {
+		arq.probeTs = 0
+		arq.probeWait = 0
+		return
+	}
+
+	if arq.probeWait == 0 {
+		arq.probeWait = arqProbeInitial
+		arq.probeTs = current + arq.probeWait
+		return
+	}
+
+	if timeDiff(current, arq.probeTs) < 0 {
+		return
+	}
+
+	arq.probeWait += arq.probeWait / 2
+
+	if arq.probeWait > arqProbeLimit {
+		arq.probeWait = arqProbeLimit
+	}
+
+	arq.probeTs = current + arq.probeWait
+	arq.probeAsk = true
+}
+
+func newARQ(conv uint32, settings ReliableUDPSettings, output func(datagram []byte)) *arq {
+	return &arq{
+		conv:       conv,
+		mtu:        settings.MTU,
+		mss:        settings.MTU - arqHeaderSize,
+		output:     output,
+		ssthresh:   arqInitialSSThresh,
+		cwnd:       1,
+		incr:       uint32(settings.MTU - arqHeaderSize),
+		rxRto:      arqInitialRTO,
+		rxMinRto:   uint32(settings.MinRTO / time.Millisecond),
+		sndWnd:     uint32(settings.SendWindow),
+		rcvWnd:     uint32(settings.RecvWindow),
+		rmtWnd:     uint32(settings.RecvWindow),
+		interval:   uint32(settings.Interval / time.Millisecond),
+		fastResend: uint32(settings.FastResend),
+		noCwnd:     settings.NoCongestionControl,
+		deadLink:   uint32(settings.DeadLink),
+		buffer:     make([]byte, 0, settings.MTU),
+	}
+}
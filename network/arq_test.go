@@ -0,0 +1,278 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// arqLink connects two arq endpoints in memory. Datagrams are queued rather
+// than delivered so that tests decide what is lost and in which order the
+// rest arrives.
+type arqLink struct {
+	sender   *arq
+	receiver *arq
+	toRecv   [][]byte
+	toSend   [][]byte
+}
+
+func newARQLink(senderSettings ReliableUDPSettings, receiverSettings ReliableUDPSettings) *arqLink {
+	link := &arqLink{}
+	senderSettings.setDefaults()
+	receiverSettings.setDefaults()
+
+	link.sender = newARQ(1, senderSettings, func(datagram []byte) {
+		link.toRecv = append(link.toRecv, append([]byte(nil), datagram...))
+	})
+	link.receiver = newARQ(1, receiverSettings, func(datagram []byte) {
+		link.toSend = append(link.toSend, append([]byte(nil), datagram...))
+	})
+
+	return link
+}
+
+func (link *arqLink) deliverToReceiver() {
+	for _, datagram := range link.toRecv {
+		link.receiver.input(datagram)
+	}
+
+	link.toRecv = nil
+}
+
+func (link *arqLink) deliverToSender() {
+	for _, datagram := range link.toSend {
+		link.sender.input(datagram)
+	}
+
+	link.toSend = nil
+}
+
+// exchange runs one round trip without loss.
+func (link *arqLink) exchange() {
+	link.sender.flush()
+	link.deliverToReceiver()
+	link.receiver.flush()
+	link.deliverToSender()
+}
+
+func decodeARQSegments(datagram []byte) []arqSegment {
+	var segments []arqSegment
+
+	for len(datagram) >= arqHeaderSize {
+		size := int(binary.LittleEndian.Uint16(datagram[19:]))
+		segments = append(segments, arqSegment{
+			cmd:  datagram[4],
+			wnd:  binary.LittleEndian.Uint16(datagram[5:]),
+			sn:   binary.LittleEndian.Uint32(datagram[11:]),
+			una:  binary.LittleEndian.Uint32(datagram[15:]),
+			data: datagram[arqHeaderSize : arqHeaderSize+size],
+		})
+		datagram = datagram[arqHeaderSize+size:]
+	}
+
+	return segments
+}
+
+func readARQ(t *testing.T, arq *arq) []byte {
+	t.Helper()
+
+	var data []byte
+	buffer := make([]byte, 4096)
+
+	for {
+		size, _ := arq.recv(buffer)
+
+		if size == 0 {
+			return data
+		}
+
+		data = append(data, buffer[:size]...)
+	}
+}
+
+func TestARQDelivery(t *testing.T) {
+	link := newARQLink(ReliableUDPSettings{}, ReliableUDPSettings{})
+	payload := bytes.Repeat([]byte("reliable"), 1000)
+
+	link.sender.send(payload)
+
+	for i := 0; i < 20 && link.sender.waitSnd() > 0; i++ {
+		link.exchange()
+	}
+
+	if link.sender.waitSnd() != 0 {
+		t.Fatalf("%d segments still unacknowledged", link.sender.waitSnd())
+	}
+
+	if !bytes.Equal(readARQ(t, link.receiver), payload) {
+		t.Fatal("received stream differs from the sent stream")
+	}
+}
+
+func TestARQRetransmitsAfterTimeout(t *testing.T) {
+	link := newARQLink(ReliableUDPSettings{}, ReliableUDPSettings{})
+	link.sender.rxRto = 10
+
+	link.sender.send([]byte("lost once"))
+	link.sender.flush()
+	link.toRecv = nil
+
+	link.sender.flush()
+
+	if len(link.toRecv) != 0 {
+		t.Fatal("segment retransmitted before its timeout")
+	}
+
+	time.Sleep(time.Millisecond * 20)
+	link.sender.flush()
+
+	if len(link.toRecv) != 1 {
+		t.Fatalf("retransmission sent %d datagrams, want 1", len(link.toRecv))
+	}
+
+	if link.sender.sndBuf[0].xmit != 2 {
+		t.Fatalf("xmit = %d, want 2", link.sender.sndBuf[0].xmit)
+	}
+
+	link.deliverToReceiver()
+	link.receiver.flush()
+	link.deliverToSender()
+
+	if string(readARQ(t, link.receiver)) != "lost once" || link.sender.waitSnd() != 0 {
+		t.Fatal("retransmitted segment was not delivered and acknowledged")
+	}
+}
+
+func TestARQFastResend(t *testing.T) {
+	settings := ReliableUDPSettings{MTU: 50, NoCongestionControl: true}
+	link := newARQLink(settings, settings)
+	mss := link.sender.mss
+	payload := bytes.Repeat([]byte("x"), mss*4)
+
+	link.sender.send(payload)
+	link.sender.flush()
+
+	if len(link.toRecv) != 4 {
+		t.Fatalf("sent %d datagrams, want one per segment", len(link.toRecv))
+	}
+
+	sent := link.toRecv
+	link.toRecv = nil
+
+	for _, datagram := range sent[1:3] {
+		link.receiver.input(datagram)
+		link.receiver.flush()
+		link.deliverToSender()
+	}
+
+	link.sender.flush()
+
+	if len(link.toRecv) != 1 {
+		t.Fatalf("fast resend sent %d datagrams, want 1", len(link.toRecv))
+	}
+
+	segments := decodeARQSegments(link.toRecv[0])
+
+	if len(segments) != 1 || segments[0].sn != 0 {
+		t.Fatalf("fast resend sent %+v, want segment 0", segments)
+	}
+
+	link.deliverToReceiver()
+	link.receiver.input(sent[3])
+
+	if !bytes.Equal(readARQ(t, link.receiver), payload) {
+		t.Fatal("stream was not reassembled in order after fast resend")
+	}
+}
+
+func TestARQWindowProbe(t *testing.T) {
+	link := newARQLink(ReliableUDPSettings{MTU: 50, NoCongestionControl: true}, ReliableUDPSettings{MTU: 50, RecvWindow: 2})
+	payload := bytes.Repeat([]byte("y"), link.sender.mss*4)
+
+	link.sender.send(payload)
+	link.exchange()
+
+	if link.sender.rmtWnd != 0 {
+		t.Fatalf("remote window = %d, want 0 once the receiver is full", link.sender.rmtWnd)
+	}
+
+	link.sender.flush()
+	link.sender.probeTs = arqNow() - 1
+	link.sender.flush()
+
+	probed := false
+
+	for _, datagram := range link.toRecv {
+		for _, segment := range decodeARQSegments(datagram) {
+			probed = probed || segment.cmd == arqCmdProbe
+		}
+	}
+
+	if !probed {
+		t.Fatal("sender did not probe a zero window")
+	}
+
+	received := readARQ(t, link.receiver)
+	link.deliverToReceiver()
+	link.receiver.flush()
+	link.deliverToSender()
+
+	if link.sender.rmtWnd == 0 {
+		t.Fatal("window update did not reopen the remote window")
+	}
+
+	for i := 0; i < 10 && link.sender.waitSnd() > 0; i++ {
+		link.exchange()
+		received = append(received, readARQ(t, link.receiver)...)
+	}
+
+	if !bytes.Equal(received, payload) {
+		t.Fatal("stream was not delivered after the window reopened")
+	}
+}
+
+func TestARQFinReportsEOF(t *testing.T) {
+	link := newARQLink(ReliableUDPSettings{}, ReliableUDPSettings{})
+
+	link.sender.send([]byte("bye"))
+	link.sender.sendControl(arqCmdFin)
+
+	for i := 0; i < 10 && link.sender.waitSnd() > 0; i++ {
+		link.exchange()
+	}
+
+	buffer := make([]byte, 16)
+	size, eof := link.receiver.recv(buffer)
+
+	if string(buffer[:size]) != "bye" || eof {
+		t.Fatalf("first recv = %q, eof %v, want \"bye\" without eof", buffer[:size], eof)
+	}
+
+	size, eof = link.receiver.recv(buffer)
+
+	if size != 0 || !eof {
+		t.Fatalf("second recv = %d bytes, eof %v, want eof", size, eof)
+	}
+}
+
+func TestARQDeadLink(t *testing.T) {
+	link := newARQLink(ReliableUDPSettings{DeadLink: 3}, ReliableUDPSettings{})
+	link.sender.rxRto = 1
+
+	link.sender.send([]byte("nobody home"))
+
+	for i := 0; i < 100 && !link.sender.dead; i++ {
+		link.sender.flush()
+		link.toRecv = nil
+		time.Sleep(time.Millisecond * 2)
+	}
+
+	if !link.sender.dead {
+		t.Fatal("link never declared dead")
+	}
+
+	if link.sender.sndBuf[0].xmit != 3 {
+		t.Fatalf("declared dead after %d transmissions, want 3", link.sender.sndBuf[0].xmit)
+	}
+}
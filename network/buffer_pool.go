@@ -0,0 +1,60 @@
+package network
+
+import (
+	"math/bits"
+	"sync"
+)
+
+const (
+	minPooledBufferShift = 6
+	maxPooledBufferShift = 24
+)
+
+var bufferPools [maxPooledBufferShift - minPooledBufferShift + 1]sync.Pool
+
+func bufferPoolIndex(size int) int {
+	if size <= 1<<minPooledBufferShift {
+		return 0
+	}
+
+	shift := bits.Len(uint(size - 1))
+
+	if shift > maxPooledBufferShift {
+		return -1
+	}
+
+	return shift - minPooledBufferShift
+}
+
+func getBuffer(size int) []byte {
+	index := bufferPoolIndex(size)
+
+	if index < 0 {
+		return make([]byte, size)
+	}
+
+	buffer, ok := bufferPools[index].Get().(*[]byte)
+
+	if !ok {
+		return make([]byte, size, 1<<(index+minPooledBufferShift))
+	}
+
+	return (*buffer)[:size]
+}
+
+func putBuffer(buffer []byte) {
+	size := cap(buffer)
+
+	if size&(size-1) != 0 {
+		return
+	}
+
+	index := bufferPoolIndex(size)
+
+	if index < 0 || 1<<(index+minPooledBufferShift) != size {
+		return
+	}
+
+	buffer = buffer[:0]
+	bufferPools[index].Put(&buffer)
+}
@@ -0,0 +1,52 @@
+package network
+
+import (
+	"bufio"
+	"net"
+)
+
+const defaultReadBufferSize = byteOfSize * 16
+
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+type countingReader struct {
+	conn   net.Conn
+	onRead func(size int)
+}
+
+func (reader *countingReader) Read(data []byte) (int, error) {
+	size, err := reader.conn.Read(data)
+
+	if size > 0 {
+		reader.onRead(size)
+	}
+
+	return size, err
+}
+
+func (conn *bufferedConn) Read(data []byte) (int, error) {
+	return conn.reader.Read(data)
+}
+
+func (conn *bufferedConn) ReadByte() (byte, error) {
+	return conn.reader.ReadByte()
+}
+
+func (conn *bufferedConn) buffered() int {
+	return conn.reader.Buffered()
+}
+
+func newBufferedConn(conn net.Conn, size int, onRead func(size int)) *bufferedConn {
+	reader := &countingReader{
+		conn:   conn,
+		onRead: onRead,
+	}
+
+	return &bufferedConn{
+		Conn:   conn,
+		reader: bufio.NewReaderSize(reader, size),
+	}
+}
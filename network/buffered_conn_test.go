@@ -0,0 +1,132 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+)
+
+var benchmarkFrameSizes = []int{64, 1024, 16384}
+
+// newFrameStream returns a loopback TCP connection whose peer writes frames
+// of frameSize bytes until the benchmark ends.
+func newFrameStream(b *testing.B, frameSize int) net.Conn {
+	b.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		frame := buildPacket(bytes.Repeat([]byte{'x'}, frameSize))
+		chunk := bytes.Repeat(frame, 64)
+
+		for {
+			_, err := conn.Write(chunk)
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Cleanup(func() {
+		conn.Close()
+	})
+
+	return conn
+}
+
+// parseUnpooledPacketHeader is the header parser the session used before the
+// receive path was buffered: it allocates a fresh header for every packet.
+func parseUnpooledPacketHeader(conn net.Conn, maxRecvBuffSize int) (int, error) {
+	packetHeader := make([]byte, 4)
+	err := readFull(conn, packetHeader)
+
+	if err != nil {
+		return 0, err
+	}
+
+	packetSize := int(binary.BigEndian.Uint32(packetHeader))
+	err = checkPacketSize(packetSize, maxRecvBuffSize)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return packetSize, nil
+}
+
+// BenchmarkRecvUnbuffered measures the receive path before buffering: two
+// reads from the connection and two allocations per packet.
+func BenchmarkRecvUnbuffered(b *testing.B) {
+	for _, frameSize := range benchmarkFrameSizes {
+		b.Run(fmt.Sprint(frameSize), func(b *testing.B) {
+			conn := newFrameStream(b, frameSize)
+			b.SetBytes(int64(frameSize))
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				packetSize, err := parseUnpooledPacketHeader(conn, maxPacketSize)
+
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				_, err = parsePacketBody(conn, packetSize)
+
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRecvBufferedPooled(b *testing.B) {
+	for _, frameSize := range benchmarkFrameSizes {
+		b.Run(fmt.Sprint(frameSize), func(b *testing.B) {
+			conn := newBufferedConn(newFrameStream(b, frameSize), defaultReadBufferSize, func(size int) {})
+			b.SetBytes(int64(frameSize))
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				packetSize, err := parsePacketHeader(conn, maxPacketSize)
+
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				packet, err := parsePooledPacketBody(conn, packetSize)
+
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				putBuffer(packet)
+			}
+		})
+	}
+}
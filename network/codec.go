@@ -0,0 +1,174 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+)
+
+var (
+	ErrNoCodec          = errors.New("session has no codec")
+	ErrNoMessageFactory = errors.New("codec has no message factory")
+	ErrInvalidMessage   = errors.New("message does not match the codec")
+)
+
+type NewMessageFunc func() interface{}
+
+type Codec interface {
+	Encode(msg interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+	DecodeInto(data []byte, msg interface{}) error
+}
+
+type ProtoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+type jsonCodec struct {
+	newMessage NewMessageFunc
+}
+
+func (codec *jsonCodec) Encode(msg interface{}) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (codec *jsonCodec) Decode(data []byte) (interface{}, error) {
+	if codec.newMessage == nil {
+		var msg interface{}
+		err := json.Unmarshal(data, &msg)
+
+		return msg, err
+	}
+
+	msg := codec.newMessage()
+	err := codec.DecodeInto(data, msg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (codec *jsonCodec) DecodeInto(data []byte, msg interface{}) error {
+	return json.Unmarshal(data, msg)
+}
+
+func NewJSONCodec(newMessage NewMessageFunc) Codec {
+	return &jsonCodec{
+		newMessage: newMessage,
+	}
+}
+
+type gobCodec struct {
+	newMessage NewMessageFunc
+}
+
+func (codec *gobCodec) Encode(msg interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := gob.NewEncoder(&buffer)
+
+	if codec.newMessage == nil {
+		err := encoder.Encode(&msg)
+
+		return buffer.Bytes(), err
+	}
+
+	err := encoder.Encode(msg)
+
+	return buffer.Bytes(), err
+}
+
+func (codec *gobCodec) Decode(data []byte) (interface{}, error) {
+	if codec.newMessage == nil {
+		var msg interface{}
+		err := codec.DecodeInto(data, &msg)
+
+		return msg, err
+	}
+
+	msg := codec.newMessage()
+	err := codec.DecodeInto(data, msg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (codec *gobCodec) DecodeInto(data []byte, msg interface{}) error {
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+
+	return decoder.Decode(msg)
+}
+
+func NewGobCodec(newMessage NewMessageFunc) Codec {
+	return &gobCodec{
+		newMessage: newMessage,
+	}
+}
+
+type protoCodec struct {
+	newMessage NewMessageFunc
+}
+
+func (codec *protoCodec) Encode(msg interface{}) ([]byte, error) {
+	message, ok := msg.(ProtoMessage)
+
+	if !ok {
+		return nil, ErrInvalidMessage
+	}
+
+	body, err := message.Marshal()
+
+	if err != nil {
+		return nil, err
+	}
+
+	packet := make([]byte, binary.MaxVarintLen64+len(body))
+	size := binary.PutUvarint(packet, uint64(len(body)))
+	size += copy(packet[size:], body)
+
+	return packet[:size], nil
+}
+
+func (codec *protoCodec) Decode(data []byte) (interface{}, error) {
+	if codec.newMessage == nil {
+		return nil, ErrNoMessageFactory
+	}
+
+	msg := codec.newMessage()
+	err := codec.DecodeInto(data, msg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (codec *protoCodec) DecodeInto(data []byte, msg interface{}) error {
+	message, ok := msg.(ProtoMessage)
+
+	if !ok {
+		return ErrInvalidMessage
+	}
+
+	bodySize, size := binary.Uvarint(data)
+
+	if size <= 0 || bodySize != uint64(len(data)-size) {
+		return ErrInvalidMessage
+	}
+
+	return message.Unmarshal(data[size:])
+}
+
+func NewProtoCodec(newMessage NewMessageFunc) Codec {
+	return &protoCodec{
+		newMessage: newMessage,
+	}
+}
@@ -0,0 +1,156 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type codecTestMessage struct {
+	Name  string
+	Count int
+}
+
+type protoTestMessage struct {
+	body string
+}
+
+func (msg *protoTestMessage) Marshal() ([]byte, error) {
+	return []byte(msg.body), nil
+}
+
+func (msg *protoTestMessage) Unmarshal(data []byte) error {
+	msg.body = string(data)
+
+	return nil
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	newMessage := func() interface{} {
+		return &codecTestMessage{}
+	}
+	tests := []struct {
+		name  string
+		codec Codec
+		msg   interface{}
+		want  interface{}
+	}{
+		{"json typed", NewJSONCodec(newMessage), &codecTestMessage{"a", 1}, &codecTestMessage{"a", 1}},
+		{"json generic", NewJSONCodec(nil), map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "a"}},
+		{"gob typed", NewGobCodec(newMessage), &codecTestMessage{"b", 2}, &codecTestMessage{"b", 2}},
+		{"gob generic", NewGobCodec(nil), "text", "text"},
+		{"proto", NewProtoCodec(func() interface{} {
+			return &protoTestMessage{}
+		}), &protoTestMessage{"c"}, &protoTestMessage{"c"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := test.codec.Encode(test.msg)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg, err := test.codec.Decode(data)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(msg, test.want) {
+				t.Fatalf("decoded %#v, want %#v", msg, test.want)
+			}
+		})
+	}
+}
+
+func TestProtoCodecErrors(t *testing.T) {
+	codec := NewProtoCodec(nil)
+
+	_, err := codec.Encode("not a proto message")
+
+	if err != ErrInvalidMessage {
+		t.Fatalf("Encode of a non-proto value = %v, want %v", err, ErrInvalidMessage)
+	}
+
+	_, err = codec.Decode([]byte{1, 'x'})
+
+	if err != ErrNoMessageFactory {
+		t.Fatalf("Decode without a factory = %v, want %v", err, ErrNoMessageFactory)
+	}
+
+	err = codec.DecodeInto([]byte{5, 'x'}, &protoTestMessage{})
+
+	if err != ErrInvalidMessage {
+		t.Fatalf("DecodeInto with a bad length = %v, want %v", err, ErrInvalidMessage)
+	}
+}
+
+func TestSessionSendAndOnMessage(t *testing.T) {
+	local, remote := net.Pipe()
+	codec := NewJSONCodec(func() interface{} {
+		return &codecTestMessage{}
+	})
+	received := make(chan interface{}, 1)
+
+	receiver := NewSessionFromConn(SessionSettings{
+		Codec: codec,
+		OnMessage: func(session *Session, msg interface{}) {
+			received <- msg
+		},
+	}, local)
+	receiver.Start()
+	defer receiver.Stop()
+
+	sender := NewSessionFromConn(SessionSettings{Codec: codec}, remote)
+	sender.Start()
+	defer sender.Stop()
+
+	err := sender.Send(&codecTestMessage{"hello", 3})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-received:
+		if !reflect.DeepEqual(msg, &codecTestMessage{"hello", 3}) {
+			t.Fatalf("OnMessage got %#v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnMessage was not called")
+	}
+}
+
+func TestSessionSendWithoutCodec(t *testing.T) {
+	session, _ := newPipeSession(t, SessionSettings{})
+
+	if !errors.Is(session.Send("msg"), ErrNoCodec) {
+		t.Fatal("Send without a codec did not fail with ErrNoCodec")
+	}
+}
+
+func TestSetCodecWhileRunning(t *testing.T) {
+	session, peer := newPipeSession(t, SessionSettings{
+		OnMessage: func(session *Session, msg interface{}) {
+		},
+	})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 100; i++ {
+			peer.Write(buildPacket([]byte(`{"Name":"x"}`)))
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		session.SetCodec(NewJSONCodec(nil))
+	}
+
+	<-done
+}
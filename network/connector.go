@@ -1,11 +1,32 @@
 package network
 
 import (
+	"crypto/tls"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+type ConnectorState int32
+
+const (
+	ConnectorDisconnected ConnectorState = iota
+	ConnectorConnecting
+	ConnectorConnected
+	ConnectorReconnecting
+	ConnectorStopped
+)
+
+var closedChannel = func() chan struct{} {
+	channel := make(chan struct{})
+	close(channel)
+
+	return channel
+}()
+
 type connectorConnectedFunc func(connector *Connector)
-type connectorDisConnected func(connector *Connector, session *Session)
+type connectorDisConnected func(connector *Connector, session *Session, reason DisconnectReason)
 type connectorErrorFunc func(connector *Connector, err error)
 
 type ConnectorSettings struct {
@@ -14,16 +35,37 @@ type ConnectorSettings struct {
 	OnError connectorErrorFunc
 
 	SessionSettings SessionSettings
+	ReconnectSettings ReconnectSettings
+	TLSConfig *tls.Config
+	HandshakeTimeout time.Duration
+	Transport Transport
+	ReliableUDP ReliableUDPSettings
 }
 
 type Connector struct {
+	stats connectorCounters
+	mutex sync.Mutex
 	session *Session
+	network string
+	address string
+	state int32
+	stop chan struct{}
+	stopOnce sync.Once
+	started int32
+	startOnce sync.Once
+	done chan struct{}
 
 	onConnected connectorConnectedFunc
 	onDisconnected connectorDisConnected
 	onError connectorErrorFunc
 
 	sessionSettings SessionSettings
+	reconnectSettings ReconnectSettings
+	tlsConfig *tls.Config
+	handshakeTimeout time.Duration
+	transport Transport
+	reliableUDP ReliableUDPSettings
+	metrics *Metrics
 }
 
 func (connector *Connector) SetConnectorSettings(settings ConnectorSettings) {
@@ -31,6 +73,11 @@ func (connector *Connector) SetConnectorSettings(settings ConnectorSettings) {
 	connector.onDisconnected = settings.OnDisconnected
 	connector.onError = settings.OnError
 	connector.sessionSettings = settings.SessionSettings
+	connector.reconnectSettings = settings.ReconnectSettings
+	connector.tlsConfig = settings.TLSConfig
+	connector.handshakeTimeout = settings.HandshakeTimeout
+	connector.transport = settings.Transport
+	connector.reliableUDP = settings.ReliableUDP
 
 	if connector.onConnected == nil {
 		connector.onConnected = func(connector *Connector) {
@@ -38,7 +85,7 @@ func (connector *Connector) SetConnectorSettings(settings ConnectorSettings) {
 	}
 
 	if connector.onDisconnected == nil {
-		connector.onDisconnected = func(connector *Connector, session *Session) {
+		connector.onDisconnected = func(connector *Connector, session *Session, reason DisconnectReason) {
 		}
 	}
 
@@ -46,34 +93,264 @@ func (connector *Connector) SetConnectorSettings(settings ConnectorSettings) {
 		connector.onError = func(connector *Connector, err error) {
 		}
 	}
+
+	if connector.handshakeTimeout <= 0 {
+		connector.handshakeTimeout = defaultHandshakeTimeout
+	}
 }
 
 func (connector *Connector) Connect(host string, port int) bool {
 	address := ComposeAddressByHostAndPort(host, port)
-	conn, err := net.Dial("tcp", address)
+
+	if connector.transport == TransportReliableUDP {
+		return connector.DialNetwork("udp", address)
+	}
+
+	return connector.DialNetwork("tcp", address)
+}
+
+// DialNetwork connects over any stream network understood by net.Dial, such
+// as "tcp6" or "unix". With TransportReliableUDP the network must be "udp",
+// "udp4" or "udp6". Reconnects reuse the same network and address.
+func (connector *Connector) DialNetwork(network string, address string) bool {
+	connector.network = network
+	connector.address = address
+
+	return connector.dial()
+}
+
+func (connector *Connector) dial() bool {
+	err := validateFramer(connector.sessionSettings.Framer)
 
 	if err != nil {
+		connector.setState(ConnectorDisconnected)
 		connector.onError(connector, err)
 		return false
 	}
 
-	s := NewSocket(conn)
-	session := NewSession(connector.sessionSettings, s)
+	connector.setState(ConnectorConnecting)
+	conn, err := connector.dialConn()
+
+	if err != nil {
+		connector.setState(ConnectorDisconnected)
+		connector.onError(connector, err)
+		return false
+	}
+
+	session := NewSessionFromConn(connector.sessionSettings, conn)
+	session.stats.parent = &connector.stats.trafficCounters
+	session.metrics = connector.getMetrics()
+	atomic.AddUint64(&connector.stats.connects, 1)
+
+	connector.mutex.Lock()
 	connector.session = session
+	connector.mutex.Unlock()
+
+	if connector.isStopped() {
+		session.Stop()
+		return false
+	}
+
+	connector.setState(ConnectorConnected)
+	connector.onConnected(connector)
 
 	return true
 }
 
+// dialConn bounds both the dial and the TLS handshake by handshakeTimeout so
+// that Connect cannot hang on an unresponsive peer.
+func (connector *Connector) dialConn() (net.Conn, error) {
+	deadline := time.Now().Add(connector.handshakeTimeout)
+	var conn net.Conn
+	var err error
+
+	if connector.transport == TransportReliableUDP {
+		conn, err = DialReliableUDP(connector.network, connector.address, connector.reliableUDP)
+	} else {
+		dialer := net.Dialer{Deadline: deadline}
+		conn, err = dialer.Dial(connector.network, connector.address)
+	}
+
+	if err != nil || connector.tlsConfig == nil {
+		return conn, err
+	}
+
+	config := connector.tlsConfig.Clone()
+
+	if config.ServerName == "" {
+		host, _, err := SplitHostAndPort(connector.address)
+
+		if err != nil {
+			host = connector.address
+		}
+
+		config.ServerName = host
+	}
+
+	tlsConn := tls.Client(conn, config)
+	tlsConn.SetDeadline(deadline)
+	err = tlsConn.Handshake()
+
+	if err != nil {
+		tlsConn.Close()
+		return nil, err
+	}
+
+	tlsConn.SetDeadline(time.Time{})
+
+	return tlsConn, nil
+}
+
+// Start runs the connector in the background. Only the first call has an
+// effect.
 func (connector *Connector) Start() {
-	connector.session.doRecvPacket()
+	connector.startOnce.Do(func() {
+		atomic.StoreInt32(&connector.started, 1)
+		go connector.run()
+	})
+}
+
+func (connector *Connector) run() {
+	defer close(connector.done)
+
+	session := connector.GetSession()
+
+	for {
+		if session != nil {
+			session.Start()
+			<-session.Done()
+			connector.onDisconnected(connector, session, session.GetDisconnectReason())
+		}
+
+		if connector.isStopped() {
+			return
+		}
+
+		connector.setState(ConnectorDisconnected)
+
+		if !connector.reconnect() {
+			return
+		}
+
+		session = connector.GetSession()
+	}
+}
+
+// Done is closed once the background loop started by Start has finished. A
+// connector that was never started reports done immediately.
+func (connector *Connector) Done() <-chan struct{} {
+	if atomic.LoadInt32(&connector.started) == 0 {
+		return closedChannel
+	}
+
+	return connector.done
+}
+
+func (connector *Connector) Wait() {
+	<-connector.Done()
+}
+
+func (connector *Connector) reconnect() bool {
+	if !connector.reconnectSettings.Enable {
+		return false
+	}
+
+	b := newBackoff(connector.reconnectSettings)
+
+	for {
+		delay, ok := b.next()
+
+		if !ok {
+			connector.setState(ConnectorDisconnected)
+			return false
+		}
+
+		connector.setState(ConnectorReconnecting)
+		atomic.AddUint64(&connector.stats.reconnectAttempts, 1)
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-connector.stop:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+
+		if connector.dial() {
+			return true
+		}
+
+		if connector.isStopped() {
+			return false
+		}
+	}
 }
 
 func (connector *Connector) Stop() {
-	connector.session.Stop()
+	connector.stopOnce.Do(func() {
+		close(connector.stop)
+	})
+
+	connector.setState(ConnectorStopped)
+	session := connector.GetSession()
+
+	if session != nil {
+		session.Stop()
+	}
+}
+
+func (connector *Connector) setMetrics(metrics *Metrics) {
+	connector.mutex.Lock()
+	defer connector.mutex.Unlock()
+
+	connector.metrics = metrics
+}
+
+func (connector *Connector) getMetrics() *Metrics {
+	connector.mutex.Lock()
+	defer connector.mutex.Unlock()
+
+	return connector.metrics
+}
+
+func (connector *Connector) isStopped() bool {
+	select {
+	case <-connector.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (connector *Connector) setState(state ConnectorState) {
+	if connector.isStopped() {
+		state = ConnectorStopped
+	}
+
+	atomic.StoreInt32(&connector.state, int32(state))
+}
+
+func (connector *Connector) GetState() ConnectorState {
+	return ConnectorState(atomic.LoadInt32(&connector.state))
+}
+
+func (connector *Connector) Stats() ConnectorStats {
+	return connector.stats.snapshot(connector.GetState())
+}
+
+func (connector *Connector) GetSession() *Session {
+	connector.mutex.Lock()
+	defer connector.mutex.Unlock()
+
+	return connector.session
 }
 
 func NewConnector(settings ConnectorSettings) *Connector {
-	connector := &Connector{}
+	connector := &Connector{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
 	connector.SetConnectorSettings(settings)
 
 	return connector
@@ -0,0 +1,62 @@
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func startTestAcceptor(t *testing.T, settings AcceptorSettings) (*Acceptor, string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acceptor := NewAcceptor(settings)
+
+	if !acceptor.Serve(listener) {
+		t.Fatal("acceptor failed to serve")
+	}
+
+	t.Cleanup(acceptor.Stop)
+
+	return acceptor, listener.Addr().String()
+}
+
+func TestConnectorStartTwice(t *testing.T) {
+	_, address := startTestAcceptor(t, AcceptorSettings{})
+	connector := NewConnector(ConnectorSettings{})
+
+	if !connector.DialNetwork("tcp", address) {
+		t.Fatal("connect failed")
+	}
+
+	connector.Start()
+	connector.Start()
+	connector.Stop()
+
+	select {
+	case <-connector.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("connector did not finish after Stop")
+	}
+}
+
+func TestConnectorWaitWithoutStart(t *testing.T) {
+	connector := NewConnector(ConnectorSettings{})
+	done := make(chan struct{})
+
+	go func() {
+		connector.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait blocked on a connector that was never started")
+	}
+}
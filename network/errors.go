@@ -0,0 +1,223 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+var (
+	ErrPacketTooLarge    = errors.New("packet too large")
+	ErrInvalidPacketSize = errors.New("invalid packet size")
+	ErrShortRead         = errors.New("short read")
+	ErrShortWrite        = errors.New("short write")
+	ErrPeerClosed        = fmt.Errorf("peer closed the connection: %w", io.EOF)
+	ErrLocalClose        = errors.New("connection closed locally")
+	ErrTimeout           = errors.New("timeout")
+	ErrProtocolViolation = errors.New("protocol violation")
+	ErrSendQueueFull     = errors.New("send queue is full")
+	ErrSessionClosed     = errors.New("session is closed")
+	ErrRateLimited       = errors.New("inbound rate limit exceeded")
+	ErrAcceptorShutdown  = errors.New("acceptor is shutting down")
+
+	ErrIdleTimeout   error = &TimeoutError{Reason: "idle timeout"}
+	ErrHeartbeatLost error = &TimeoutError{Reason: "heartbeat lost"}
+	ErrWriteTimeout  error = &TimeoutError{Reason: "write timeout"}
+
+	ErrWriteIdleTimeout error = &TimeoutError{Reason: "write idle timeout"}
+
+	ErrDialTimeout     error = &TimeoutError{Reason: "dial timeout"}
+	ErrPeerUnreachable error = &TimeoutError{Reason: "peer unreachable"}
+)
+
+type PacketSizeError struct {
+	Size  int
+	Limit int
+}
+
+func (err *PacketSizeError) Error() string {
+	if err.Size <= 0 {
+		return fmt.Sprintf("invalid packet size %d", err.Size)
+	}
+
+	return fmt.Sprintf("packet size %d exceeds the limit of %d bytes", err.Size, err.Limit)
+}
+
+func (err *PacketSizeError) Is(target error) bool {
+	switch target {
+	case ErrProtocolViolation:
+		return true
+	case ErrPacketTooLarge:
+		return err.Size > err.Limit
+	case ErrInvalidPacketSize:
+		return err.Size <= 0
+	default:
+		return false
+	}
+}
+
+type ShortReadError struct {
+	Expected int
+	Actual   int
+}
+
+func (err *ShortReadError) Error() string {
+	return fmt.Sprintf("short read: expected %d bytes, got %d", err.Expected, err.Actual)
+}
+
+func (err *ShortReadError) Is(target error) bool {
+	return target == ErrShortRead
+}
+
+type ShortWriteError struct {
+	Expected int
+	Actual   int
+}
+
+func (err *ShortWriteError) Error() string {
+	return fmt.Sprintf("short write: expected %d bytes, wrote %d", err.Expected, err.Actual)
+}
+
+func (err *ShortWriteError) Is(target error) bool {
+	return target == ErrShortWrite
+}
+
+type TimeoutError struct {
+	Reason string
+}
+
+func (err *TimeoutError) Error() string {
+	return err.Reason
+}
+
+func (err *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+func (err *TimeoutError) Timeout() bool {
+	return true
+}
+
+func (err *TimeoutError) Temporary() bool {
+	return false
+}
+
+type ProtocolError struct {
+	Reason string
+}
+
+func (err *ProtocolError) Error() string {
+	return "protocol violation: " + err.Reason
+}
+
+func (err *ProtocolError) Is(target error) bool {
+	return target == ErrProtocolViolation
+}
+
+type DisconnectCode int
+
+const (
+	DisconnectUnknown DisconnectCode = iota
+	DisconnectPeerClosed
+	DisconnectLocalClose
+	DisconnectShutdown
+	DisconnectTimeout
+	DisconnectProtocolError
+	DisconnectSlowConsumer
+	DisconnectNetworkError
+	DisconnectRateLimited
+)
+
+var disconnectCodeNames = map[DisconnectCode]string{
+	DisconnectUnknown:       "unknown",
+	DisconnectPeerClosed:    "peer closed",
+	DisconnectLocalClose:    "local close",
+	DisconnectShutdown:      "shutdown",
+	DisconnectTimeout:       "timeout",
+	DisconnectProtocolError: "protocol error",
+	DisconnectSlowConsumer:  "slow consumer",
+	DisconnectNetworkError:  "network error",
+	DisconnectRateLimited:   "rate limited",
+}
+
+func (code DisconnectCode) String() string {
+	name, ok := disconnectCodeNames[code]
+
+	if !ok {
+		return disconnectCodeNames[DisconnectUnknown]
+	}
+
+	return name
+}
+
+type DisconnectReason struct {
+	Code DisconnectCode
+	Err  error
+}
+
+func (reason DisconnectReason) String() string {
+	if reason.Err == nil {
+		return reason.Code.String()
+	}
+
+	return reason.Code.String() + ": " + reason.Err.Error()
+}
+
+func NewDisconnectReason(err error) DisconnectReason {
+	return DisconnectReason{
+		Code: classifyDisconnect(err),
+		Err:  err,
+	}
+}
+
+func classifyDisconnect(err error) DisconnectCode {
+	var netErr net.Error
+
+	switch {
+	case err == nil:
+		return DisconnectUnknown
+	case errors.Is(err, ErrAcceptorShutdown):
+		return DisconnectShutdown
+	case errors.Is(err, ErrLocalClose), errors.Is(err, net.ErrClosed):
+		return DisconnectLocalClose
+	case errors.Is(err, ErrSendQueueFull):
+		return DisconnectSlowConsumer
+	case errors.Is(err, ErrRateLimited):
+		return DisconnectRateLimited
+	case errors.Is(err, ErrProtocolViolation):
+		return DisconnectProtocolError
+	case errors.Is(err, ErrTimeout), errors.Is(err, os.ErrDeadlineExceeded):
+		return DisconnectTimeout
+	case errors.Is(err, io.EOF), errors.Is(err, ErrShortRead), errors.Is(err, syscall.ECONNRESET):
+		return DisconnectPeerClosed
+	case errors.As(err, &netErr):
+		return DisconnectNetworkError
+	default:
+		return DisconnectUnknown
+	}
+}
+
+func checkPacketSize(size int, limit int) error {
+	if size <= 0 || size > limit {
+		return &PacketSizeError{Size: size, Limit: limit}
+	}
+
+	return nil
+}
+
+func readFull(reader io.Reader, buffer []byte) error {
+	size, err := io.ReadFull(reader, buffer)
+
+	if err == io.EOF {
+		return ErrPeerClosed
+	}
+
+	if err == io.ErrUnexpectedEOF {
+		return &ShortReadError{Expected: len(buffer), Actual: size}
+	}
+
+	return err
+}
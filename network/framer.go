@@ -0,0 +1,447 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+)
+
+var (
+	ErrInvalidLengthFieldSize   = errors.New("length field size must be 1, 2, 4 or 8")
+	ErrInvalidLengthFieldOffset = errors.New("length field offset must not be negative")
+	ErrInvalidHeaderPrefix      = errors.New("header prefix length must equal the length field offset")
+	ErrInvalidLengthAdjustment  = errors.New("length adjustment must not be negative")
+	ErrInvalidBytesToStrip      = errors.New("initial bytes to strip must not be negative")
+	ErrNoDelimiter              = errors.New("delimiter framer has no delimiters")
+	ErrEmptyDelimiter           = errors.New("delimiter must not be empty")
+	ErrDelimiterInPayload       = errors.New("payload contains a delimiter")
+)
+
+type Framer interface {
+	ReadFrame(conn net.Conn, maxRecvBuffSize int) ([]byte, error)
+	BuildFrame(data []byte) []byte
+}
+
+// frameChecker is implemented by framers that cannot encode every payload.
+// The session calls checkFrame before BuildFrame so that misconfiguration and
+// oversize payloads surface as errors from SendPacket.
+type frameChecker interface {
+	validate() error
+	checkFrame(data []byte) error
+}
+
+// validateFramer reports a framer configuration that can never work, so that
+// acceptors and connectors refuse to start instead of failing per packet.
+func validateFramer(framer Framer) error {
+	checker, ok := framer.(frameChecker)
+
+	if !ok {
+		return nil
+	}
+
+	return checker.validate()
+}
+
+type packetCallbackFramer struct {
+	session *Session
+	control bool
+}
+
+// ReadFrame records in control whether the frame just read was flagged as a
+// control frame, which is only possible with the built-in header.
+func (framer *packetCallbackFramer) ReadFrame(conn net.Conn, maxRecvBuffSize int) ([]byte, error) {
+	var packetSize int
+	var err error
+
+	if framer.session.controlFrames {
+		packetSize, framer.control, err = parseFrameHeader(conn, maxRecvBuffSize)
+	} else {
+		packetSize, err = framer.session.OnParsePacketHeader(conn, maxRecvBuffSize)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkPacketSize(packetSize, maxRecvBuffSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if framer.session.reuseReadBuffers {
+		return parsePooledPacketBody(conn, packetSize)
+	}
+
+	return parsePacketBody(conn, packetSize)
+}
+
+func (framer *packetCallbackFramer) validate() error {
+	return nil
+}
+
+// checkFrame rejects empty payloads, which the peer would read as an invalid
+// zero packet size.
+func (framer *packetCallbackFramer) checkFrame(data []byte) error {
+	if len(data) == 0 {
+		return ErrInvalidPacketSize
+	}
+
+	return nil
+}
+
+func (framer *packetCallbackFramer) BuildFrame(data []byte) []byte {
+	return framer.session.OnBuildPacket(data)
+}
+
+func (framer *packetCallbackFramer) buildOutboundPacket(data []byte) outboundPacket {
+	if !framer.session.defaultBuildPacket {
+		return outboundPacket{payload: framer.BuildFrame(data)}
+	}
+
+	return outboundPacket{
+		header:  buildPooledPacketHeader(data),
+		payload: data,
+		pooled:  true,
+	}
+}
+
+// LengthFieldFramer frames packets as HeaderPrefix, a length field and the
+// payload. By default ReadFrame strips the header, so it returns exactly the
+// payload passed to BuildFrame. InitialBytesToStrip overrides how many bytes are
+// stripped from the start of the frame, and KeepHeader delivers the whole frame.
+type LengthFieldFramer struct {
+	LengthFieldOffset   int
+	LengthFieldSize     int
+	ByteOrder           binary.ByteOrder
+	LengthAdjustment    int
+	InitialBytesToStrip int
+	KeepHeader          bool
+	HeaderPrefix        []byte
+}
+
+func (framer *LengthFieldFramer) ReadFrame(conn net.Conn, maxRecvBuffSize int) ([]byte, error) {
+	err := framer.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	headerSize := framer.headerSize()
+	header := make([]byte, headerSize)
+	err = readFull(conn, header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	length := framer.readLength(header[framer.LengthFieldOffset:])
+	bodySize := length + int64(framer.LengthAdjustment)
+
+	if bodySize < 0 || bodySize > int64(maxRecvBuffSize) {
+		return nil, &PacketSizeError{Size: int(bodySize), Limit: maxRecvBuffSize}
+	}
+
+	frame := make([]byte, headerSize+int(bodySize))
+	copy(frame, header)
+	err = readFull(conn, frame[headerSize:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	strip := framer.bytesToStrip()
+
+	if strip > len(frame) {
+		return nil, &ProtocolError{Reason: "frame is shorter than the bytes to strip"}
+	}
+
+	return frame[strip:], nil
+}
+
+func (framer *LengthFieldFramer) BuildFrame(data []byte) []byte {
+	headerSize := framer.headerSize()
+	frame := make([]byte, headerSize+len(data))
+	copy(frame[:framer.LengthFieldOffset], framer.HeaderPrefix)
+	framer.writeLength(frame[framer.LengthFieldOffset:], int64(len(data)-framer.LengthAdjustment))
+	copy(frame[headerSize:], data)
+
+	return frame
+}
+
+func (framer *LengthFieldFramer) validate() error {
+	if !isValidLengthFieldSize(framer.lengthFieldSize()) {
+		return ErrInvalidLengthFieldSize
+	}
+
+	if framer.LengthFieldOffset < 0 {
+		return ErrInvalidLengthFieldOffset
+	}
+
+	if len(framer.HeaderPrefix) != framer.LengthFieldOffset {
+		return ErrInvalidHeaderPrefix
+	}
+
+	if framer.LengthAdjustment < 0 {
+		return ErrInvalidLengthAdjustment
+	}
+
+	if framer.InitialBytesToStrip < 0 {
+		return ErrInvalidBytesToStrip
+	}
+
+	return nil
+}
+
+func (framer *LengthFieldFramer) checkFrame(data []byte) error {
+	err := framer.validate()
+
+	if err != nil {
+		return err
+	}
+
+	size := len(data)
+	length := int64(size) - int64(framer.LengthAdjustment)
+
+	if length < 0 {
+		return &PacketSizeError{Size: int(length), Limit: size}
+	}
+
+	maxLength := framer.maxLength()
+
+	if length > maxLength {
+		return &PacketSizeError{Size: size, Limit: int(maxLength) + framer.LengthAdjustment}
+	}
+
+	return nil
+}
+
+func (framer *LengthFieldFramer) maxLength() int64 {
+	if framer.lengthFieldSize() == 8 {
+		return math.MaxInt64
+	}
+
+	return 1<<(8*uint(framer.lengthFieldSize())) - 1
+}
+
+func (framer *LengthFieldFramer) headerSize() int {
+	return framer.LengthFieldOffset + framer.lengthFieldSize()
+}
+
+func (framer *LengthFieldFramer) bytesToStrip() int {
+	if framer.InitialBytesToStrip > 0 {
+		return framer.InitialBytesToStrip
+	}
+
+	if framer.KeepHeader {
+		return 0
+	}
+
+	return framer.headerSize()
+}
+
+func (framer *LengthFieldFramer) lengthFieldSize() int {
+	if framer.LengthFieldSize == 0 {
+		return 4
+	}
+
+	return framer.LengthFieldSize
+}
+
+func (framer *LengthFieldFramer) byteOrder() binary.ByteOrder {
+	if framer.ByteOrder == nil {
+		return binary.BigEndian
+	}
+
+	return framer.ByteOrder
+}
+
+func (framer *LengthFieldFramer) readLength(data []byte) int64 {
+	switch framer.lengthFieldSize() {
+	case 1:
+		return int64(data[0])
+	case 2:
+		return int64(framer.byteOrder().Uint16(data))
+	case 4:
+		return int64(framer.byteOrder().Uint32(data))
+	default:
+		return int64(framer.byteOrder().Uint64(data))
+	}
+}
+
+func (framer *LengthFieldFramer) writeLength(data []byte, length int64) {
+	switch framer.lengthFieldSize() {
+	case 1:
+		data[0] = byte(length)
+	case 2:
+		framer.byteOrder().PutUint16(data, uint16(length))
+	case 4:
+		framer.byteOrder().PutUint32(data, uint32(length))
+	default:
+		framer.byteOrder().PutUint64(data, uint64(length))
+	}
+}
+
+func isValidLengthFieldSize(size int) bool {
+	switch size {
+	case 1, 2, 4, 8:
+		return true
+	default:
+		return false
+	}
+}
+
+type DelimiterFramer struct {
+	Delimiters     [][]byte
+	MaxFrameLength int
+	KeepDelimiter  bool
+}
+
+func (framer *DelimiterFramer) ReadFrame(conn net.Conn, maxRecvBuffSize int) ([]byte, error) {
+	if len(framer.Delimiters) == 0 {
+		return nil, ErrNoDelimiter
+	}
+
+	maxFrameLength := framer.MaxFrameLength
+
+	if maxFrameLength <= 0 || maxFrameLength > maxRecvBuffSize {
+		maxFrameLength = maxRecvBuffSize
+	}
+
+	reader := newByteReader(conn)
+	var frame []byte
+
+	for {
+		b, err := reader.ReadByte()
+
+		if err == io.EOF {
+			return nil, ErrPeerClosed
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		frame = append(frame, b)
+		delimiter := framer.matchDelimiter(frame)
+
+		if delimiter != nil {
+			if framer.KeepDelimiter {
+				return frame, nil
+			}
+
+			return frame[:len(frame)-len(delimiter)], nil
+		}
+
+		if len(frame) > maxFrameLength+framer.maxDelimiterLength() {
+			return nil, &PacketSizeError{Size: len(frame), Limit: maxFrameLength}
+		}
+	}
+}
+
+func (framer *DelimiterFramer) BuildFrame(data []byte) []byte {
+	if len(framer.Delimiters) == 0 {
+		return data
+	}
+
+	delimiter := framer.Delimiters[0]
+	frame := make([]byte, len(data)+len(delimiter))
+	copy(frame, data)
+	copy(frame[len(data):], delimiter)
+
+	return frame
+}
+
+func (framer *DelimiterFramer) validate() error {
+	if len(framer.Delimiters) == 0 {
+		return ErrNoDelimiter
+	}
+
+	for _, delimiter := range framer.Delimiters {
+		if len(delimiter) == 0 {
+			return ErrEmptyDelimiter
+		}
+	}
+
+	return nil
+}
+
+// checkFrame rejects payloads the peer could not read back as one frame: those
+// longer than MaxFrameLength and those containing any of the delimiters.
+func (framer *DelimiterFramer) checkFrame(data []byte) error {
+	err := framer.validate()
+
+	if err != nil {
+		return err
+	}
+
+	if framer.MaxFrameLength > 0 && len(data) > framer.MaxFrameLength {
+		return &PacketSizeError{Size: len(data), Limit: framer.MaxFrameLength}
+	}
+
+	for _, delimiter := range framer.Delimiters {
+		if bytes.Contains(data, delimiter) {
+			return ErrDelimiterInPayload
+		}
+	}
+
+	return nil
+}
+
+func (framer *DelimiterFramer) matchDelimiter(frame []byte) []byte {
+	var matched []byte
+
+	for _, delimiter := range framer.Delimiters {
+		if len(delimiter) > len(matched) && bytes.HasSuffix(frame, delimiter) {
+			matched = delimiter
+		}
+	}
+
+	return matched
+}
+
+func (framer *DelimiterFramer) maxDelimiterLength() int {
+	size := 0
+
+	for _, delimiter := range framer.Delimiters {
+		if len(delimiter) > size {
+			size = len(delimiter)
+		}
+	}
+
+	return size
+}
+
+func NewLineFramer(maxFrameLength int) *DelimiterFramer {
+	return &DelimiterFramer{
+		Delimiters: [][]byte{
+			[]byte("\r\n"),
+			[]byte("\n"),
+		},
+		MaxFrameLength: maxFrameLength,
+	}
+}
+
+type singleByteReader struct {
+	reader io.Reader
+	buffer [1]byte
+}
+
+func (reader *singleByteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(reader.reader, reader.buffer[:])
+
+	return reader.buffer[0], err
+}
+
+func newByteReader(reader io.Reader) io.ByteReader {
+	byteReader, ok := reader.(io.ByteReader)
+
+	if ok {
+		return byteReader
+	}
+
+	return &singleByteReader{reader: reader}
+}
@@ -0,0 +1,252 @@
+package network
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLengthFieldFramerCheckFrame(t *testing.T) {
+	tests := []struct {
+		name   string
+		framer *LengthFieldFramer
+		size   int
+		err    error
+	}{
+		{"default field fits", &LengthFieldFramer{}, 300, nil},
+		{"one byte field fits", &LengthFieldFramer{LengthFieldSize: 1}, 255, nil},
+		{"one byte field overflows", &LengthFieldFramer{LengthFieldSize: 1}, 300, ErrPacketTooLarge},
+		{"two byte field overflows", &LengthFieldFramer{LengthFieldSize: 2}, 1 << 16, ErrPacketTooLarge},
+		{"adjustment widens the limit", &LengthFieldFramer{LengthFieldSize: 1, LengthAdjustment: 2}, 257, nil},
+		{"adjustment exceeds payload", &LengthFieldFramer{LengthFieldSize: 1, LengthAdjustment: 4}, 3, ErrInvalidPacketSize},
+		{"invalid field size", &LengthFieldFramer{LengthFieldSize: 3}, 10, ErrInvalidLengthFieldSize},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.framer.checkFrame(make([]byte, test.size))
+
+			if test.err == nil && err != nil || !errors.Is(err, test.err) {
+				t.Fatalf("checkFrame(%d) = %v, want %v", test.size, err, test.err)
+			}
+		})
+	}
+}
+
+func TestSendPacketRejectsUnencodablePayload(t *testing.T) {
+	session, _ := newPipeSession(t, SessionSettings{Framer: &LengthFieldFramer{LengthFieldSize: 3}})
+
+	err := session.SendPacket([]byte("payload"))
+
+	if !errors.Is(err, ErrInvalidLengthFieldSize) {
+		t.Fatalf("SendPacket with a 3 byte length field = %v, want %v", err, ErrInvalidLengthFieldSize)
+	}
+
+	session, _ = newPipeSession(t, SessionSettings{Framer: &LengthFieldFramer{LengthFieldSize: 1}})
+	err = session.SendPacket(make([]byte, 300))
+	var sizeErr *PacketSizeError
+
+	if !errors.As(err, &sizeErr) || sizeErr.Size != 300 || sizeErr.Limit != 255 {
+		t.Fatalf("SendPacket of 300 bytes with a 1 byte length field = %v, want PacketSizeError", err)
+	}
+}
+
+func TestInvalidFramerFailsUpFront(t *testing.T) {
+	settings := SessionSettings{Framer: &LengthFieldFramer{LengthFieldSize: 3}}
+	var acceptorErr, connectorErr error
+
+	acceptor := NewAcceptor(AcceptorSettings{
+		SessionSettings: settings,
+		OnError: func(acceptor *Acceptor, err error) {
+			acceptorErr = err
+		},
+	})
+
+	if acceptor.Listen("tcp", "127.0.0.1:0") || acceptorErr != ErrInvalidLengthFieldSize {
+		t.Fatalf("acceptor Listen error = %v, want %v", acceptorErr, ErrInvalidLengthFieldSize)
+	}
+
+	connector := NewConnector(ConnectorSettings{
+		SessionSettings: settings,
+		OnError: func(connector *Connector, err error) {
+			connectorErr = err
+		},
+	})
+
+	if connector.DialNetwork("tcp", "127.0.0.1:1") || connectorErr != ErrInvalidLengthFieldSize {
+		t.Fatalf("connector dial error = %v, want %v", connectorErr, ErrInvalidLengthFieldSize)
+	}
+}
+
+func TestEmptyPayloadsPerFramer(t *testing.T) {
+	tests := []struct {
+		name   string
+		framer Framer
+		err    error
+	}{
+		{"built-in", nil, ErrInvalidPacketSize},
+		{"length field", &LengthFieldFramer{}, nil},
+		{"delimiter", NewLineFramer(0), nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session, peer := newPipeSession(t, SessionSettings{Framer: test.framer})
+
+			go io.Copy(io.Discard, peer)
+
+			err := session.SendPacket([]byte{})
+
+			if err != test.err {
+				t.Fatalf("SendPacket of an empty payload = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestDelimiterFramerEmptyLineRoundTrip(t *testing.T) {
+	received := make(chan []byte, 1)
+	local, remote := net.Pipe()
+
+	receiver := NewSessionFromConn(SessionSettings{
+		Framer: NewLineFramer(0),
+		OnRead: func(session *Session, data []byte, size int) {
+			received <- append([]byte(nil), data...)
+		},
+	}, local)
+	receiver.Start()
+	defer receiver.Stop()
+
+	sender := NewSessionFromConn(SessionSettings{Framer: NewLineFramer(0)}, remote)
+	sender.Start()
+	defer sender.Stop()
+
+	err := sender.SendPacket(nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case data := <-received:
+		if len(data) != 0 {
+			t.Fatalf("received %q, want an empty line", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("empty line was not delivered")
+	}
+}
+
+func TestLengthFieldFramerValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		framer *LengthFieldFramer
+		err    error
+	}{
+		{"defaults", &LengthFieldFramer{}, nil},
+		{"prefix matches offset", &LengthFieldFramer{LengthFieldOffset: 2, HeaderPrefix: []byte{1, 2}}, nil},
+		{"negative offset", &LengthFieldFramer{LengthFieldOffset: -1}, ErrInvalidLengthFieldOffset},
+		{"missing prefix", &LengthFieldFramer{LengthFieldOffset: 2}, ErrInvalidHeaderPrefix},
+		{"prefix without offset", &LengthFieldFramer{HeaderPrefix: []byte{1}}, ErrInvalidHeaderPrefix},
+		{"negative adjustment", &LengthFieldFramer{LengthAdjustment: -1}, ErrInvalidLengthAdjustment},
+		{"negative strip", &LengthFieldFramer{InitialBytesToStrip: -1}, ErrInvalidBytesToStrip},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.framer.validate()
+
+			if err != test.err {
+				t.Fatalf("validate() = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestLengthFieldFramerRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		framer *LengthFieldFramer
+		data   []byte
+		want   []byte
+	}{
+		{"default", &LengthFieldFramer{}, []byte("hi"), []byte("hi")},
+		{"empty body", &LengthFieldFramer{}, []byte{}, []byte{}},
+		{"prefix and adjustment", &LengthFieldFramer{LengthFieldOffset: 1, HeaderPrefix: []byte{7}, LengthFieldSize: 2, LengthAdjustment: 1}, []byte("hi"), []byte("hi")},
+		{"keep header", &LengthFieldFramer{LengthFieldSize: 1, KeepHeader: true}, []byte("hi"), []byte("\x02hi")},
+		{"explicit strip", &LengthFieldFramer{LengthFieldSize: 1, InitialBytesToStrip: 2}, []byte("hi"), []byte("i")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			local, remote := net.Pipe()
+			defer local.Close()
+			defer remote.Close()
+
+			go remote.Write(test.framer.BuildFrame(test.data))
+
+			frame, err := test.framer.ReadFrame(local, 1024)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(frame) != string(test.want) {
+				t.Fatalf("ReadFrame() = %q, want %q", frame, test.want)
+			}
+		})
+	}
+}
+
+func TestDelimiterFramerCheckFrame(t *testing.T) {
+	tests := []struct {
+		name   string
+		framer *DelimiterFramer
+		data   string
+		err    error
+	}{
+		{"plain line", NewLineFramer(16), "hello", nil},
+		{"empty line", NewLineFramer(16), "", nil},
+		{"at the limit", NewLineFramer(5), "hello", nil},
+		{"over the limit", NewLineFramer(4), "hello", ErrPacketTooLarge},
+		{"no limit", NewLineFramer(0), "hello", nil},
+		{"contains newline", NewLineFramer(0), "hel\nlo", ErrDelimiterInPayload},
+		{"contains crlf", NewLineFramer(0), "hel\r\nlo", ErrDelimiterInPayload},
+		{"no delimiters", &DelimiterFramer{}, "hello", ErrNoDelimiter},
+		{"empty delimiter", &DelimiterFramer{Delimiters: [][]byte{{}}}, "hello", ErrEmptyDelimiter},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.framer.checkFrame([]byte(test.data))
+
+			if test.err == nil && err != nil || !errors.Is(err, test.err) {
+				t.Fatalf("checkFrame(%q) = %v, want %v", test.data, err, test.err)
+			}
+		})
+	}
+}
+
+func TestSendPacketRejectsUnframeableLine(t *testing.T) {
+	session, peer := newPipeSession(t, SessionSettings{Framer: NewLineFramer(10)})
+
+	go io.Copy(io.Discard, peer)
+
+	err := session.SendPacket([]byte("two\nlines"))
+
+	if err != ErrDelimiterInPayload {
+		t.Fatalf("SendPacket of a payload with a newline = %v, want %v", err, ErrDelimiterInPayload)
+	}
+
+	err = session.SendPacket([]byte("too long line"))
+
+	if !errors.Is(err, ErrPacketTooLarge) {
+		t.Fatalf("SendPacket over MaxFrameLength = %v, want %v", err, ErrPacketTooLarge)
+	}
+
+	if session.isStopped() {
+		t.Fatal("rejecting a payload stopped the session")
+	}
+}
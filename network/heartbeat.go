@@ -0,0 +1,179 @@
+package network
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultHeartbeatInterval = time.Second * 10
+	heartbeatTimeoutFactor   = 3
+	controlFrameFlag         = 1 << 31
+)
+
+var (
+	defaultPingFrame = []byte("\x00\xffping")
+	defaultPongFrame = []byte("\x00\xffpong")
+)
+
+// HeartbeatSettings configures the ping/pong heartbeat. With the built-in
+// framing, pings and pongs are control frames flagged in the length header,
+// so they never collide with application packets and are answered even by
+// peers that have the heartbeat disabled. With a custom Framer or header
+// callbacks they are matched in-band, so Ping and Pong must not be valid
+// application payloads.
+type HeartbeatSettings struct {
+	Enable   bool
+	Interval time.Duration
+	Timeout  time.Duration
+	Ping     []byte
+	Pong     []byte
+}
+
+func (settings *HeartbeatSettings) setDefaults() {
+	if settings.Interval <= 0 {
+		settings.Interval = defaultHeartbeatInterval
+	}
+
+	if settings.Timeout <= 0 {
+		settings.Timeout = settings.Interval * heartbeatTimeoutFactor
+	}
+
+	if len(settings.Ping) == 0 {
+		settings.Ping = defaultPingFrame
+	}
+
+	if len(settings.Pong) == 0 {
+		settings.Pong = defaultPongFrame
+	}
+}
+
+func (session *Session) doHeartbeat() {
+	ticker := time.NewTicker(session.heartbeat.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-session.stop:
+			return
+		case <-session.closing:
+			return
+		case <-ticker.C:
+			session.sendControlFrame(session.heartbeat.Ping)
+		}
+	}
+}
+
+func (session *Session) doWriteIdleCheck() {
+	timer := time.NewTimer(session.writeIdleTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-session.stop:
+			return
+		case <-session.closing:
+			return
+		case <-timer.C:
+		}
+
+		idle := time.Since(session.lastWriteTime())
+
+		if idle >= session.writeIdleTimeout {
+			session.reportError(ErrWriteIdleTimeout)
+			session.stopWithReason(ErrWriteIdleTimeout)
+			return
+		}
+
+		timer.Reset(session.writeIdleTimeout - idle)
+	}
+}
+
+func (session *Session) lastWriteTime() time.Time {
+	lastWriteTime := atomic.LoadInt64(&session.stats.lastWriteTime)
+
+	if lastWriteTime == 0 {
+		lastWriteTime = session.stats.connectTime
+	}
+
+	return time.Unix(0, lastWriteTime)
+}
+
+func (session *Session) sendControlFrame(frame []byte) {
+	if !session.controlFrames {
+		session.enqueue(frame, false)
+		return
+	}
+
+	header := buildPooledPacketHeader(frame)
+	header[0] |= controlFrameFlag >> 24
+	packet := outboundPacket{
+		header:  header,
+		payload: frame,
+		pooled:  true,
+	}
+
+	err := session.sendQueue.push(packet, false)
+
+	if err != nil {
+		packet.release()
+	}
+}
+
+// handleHeartbeat consumes heartbeat frames and reports whether packet was
+// one. Control frames never reach OnRead.
+func (session *Session) handleHeartbeat(packet []byte, control bool) bool {
+	if session.controlFrames {
+		if control && bytes.Equal(packet, session.heartbeat.Ping) {
+			session.sendControlFrame(session.heartbeat.Pong)
+		}
+
+		return control
+	}
+
+	if !session.heartbeat.Enable {
+		return false
+	}
+
+	if bytes.Equal(packet, session.heartbeat.Ping) {
+		session.sendControlFrame(session.heartbeat.Pong)
+		return true
+	}
+
+	return bytes.Equal(packet, session.heartbeat.Pong)
+}
+
+func (session *Session) setReadDeadline() error {
+	timeout := session.readTimeout()
+
+	if timeout <= 0 {
+		return nil
+	}
+
+	return session.socket.conn.SetReadDeadline(time.Now().Add(timeout))
+}
+
+func (session *Session) readTimeout() time.Duration {
+	timeout := session.readIdleTimeout
+
+	if session.heartbeat.Enable && (timeout <= 0 || session.heartbeat.Timeout < timeout) {
+		timeout = session.heartbeat.Timeout
+	}
+
+	return timeout
+}
+
+func (session *Session) readTimeoutReason(err error) error {
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		return err
+	}
+
+	if session.heartbeat.Enable && session.heartbeat.Timeout == session.readTimeout() {
+		return ErrHeartbeatLost
+	}
+
+	return ErrIdleTimeout
+}
@@ -0,0 +1,152 @@
+package network
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func waitDisconnect(t *testing.T, session *Session, want error) {
+	t.Helper()
+
+	select {
+	case <-session.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatalf("session was not disconnected with %v", want)
+	}
+
+	reason := session.GetDisconnectReason()
+
+	if reason.Err != want || reason.Code != DisconnectTimeout {
+		t.Fatalf("disconnect reason = %v, want %v", reason, NewDisconnectReason(want))
+	}
+}
+
+func TestReadIdleTimeout(t *testing.T) {
+	session, _ := newPipeSession(t, SessionSettings{ReadIdleTimeout: time.Millisecond * 50})
+
+	waitDisconnect(t, session, ErrIdleTimeout)
+}
+
+func TestWriteIdleTimeout(t *testing.T) {
+	session, peer := newPipeSession(t, SessionSettings{WriteIdleTimeout: time.Millisecond * 50})
+
+	go io.Copy(io.Discard, peer)
+
+	waitDisconnect(t, session, ErrWriteIdleTimeout)
+}
+
+func TestHeartbeatLost(t *testing.T) {
+	session, peer := newPipeSession(t, SessionSettings{
+		Heartbeat: HeartbeatSettings{
+			Enable:   true,
+			Interval: time.Millisecond * 20,
+			Timeout:  time.Millisecond * 100,
+		},
+	})
+
+	go io.Copy(io.Discard, peer)
+
+	waitDisconnect(t, session, ErrHeartbeatLost)
+}
+
+func TestHeartbeatKeepsSessionAliveOutsideOnRead(t *testing.T) {
+	local, remote := net.Pipe()
+	read := make(chan []byte, 4)
+	heartbeat := HeartbeatSettings{
+		Enable:   true,
+		Interval: time.Millisecond * 20,
+		Timeout:  time.Millisecond * 100,
+	}
+
+	server := NewSessionFromConn(SessionSettings{
+		Heartbeat:        heartbeat,
+		WriteIdleTimeout: time.Millisecond * 100,
+		OnRead: func(session *Session, data []byte, size int) {
+			read <- append([]byte(nil), data...)
+		},
+	}, local)
+	server.Start()
+	defer server.Stop()
+
+	client := NewSessionFromConn(SessionSettings{}, remote)
+	client.Start()
+	defer client.Stop()
+
+	time.Sleep(time.Millisecond * 300)
+
+	select {
+	case <-server.Done():
+		t.Fatalf("heartbeat session disconnected: %v", server.GetDisconnectReason())
+	default:
+	}
+
+	err := client.SendPacket(defaultPingFrame)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case data := <-read:
+		if string(data) != string(defaultPingFrame) {
+			t.Fatalf("OnRead got %q, want the application packet", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("application packet equal to the ping payload was swallowed")
+	}
+
+	if len(read) != 0 {
+		t.Fatal("heartbeat frames reached OnRead")
+	}
+}
+
+func TestInBandHeartbeatWithLengthFieldFramer(t *testing.T) {
+	local, remote := net.Pipe()
+	read := make(chan []byte, 4)
+	settings := SessionSettings{
+		Framer: &LengthFieldFramer{},
+		Heartbeat: HeartbeatSettings{
+			Enable:   true,
+			Interval: time.Millisecond * 20,
+			Timeout:  time.Millisecond * 100,
+		},
+		OnRead: func(session *Session, data []byte, size int) {
+			read <- append([]byte(nil), data...)
+		},
+	}
+
+	server := NewSessionFromConn(settings, local)
+	server.Start()
+	defer server.Stop()
+
+	client := NewSessionFromConn(settings, remote)
+	client.Start()
+	defer client.Stop()
+
+	time.Sleep(time.Millisecond * 300)
+
+	select {
+	case <-server.Done():
+		t.Fatalf("heartbeat session disconnected: %v", server.GetDisconnectReason())
+	case <-client.Done():
+		t.Fatalf("heartbeat session disconnected: %v", client.GetDisconnectReason())
+	default:
+	}
+
+	err := client.SendPacket([]byte("hi"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case data := <-read:
+		if string(data) != "hi" {
+			t.Fatalf("OnRead got %q, want \"hi\"", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("packet was not delivered")
+	}
+}
@@ -0,0 +1,118 @@
+package network
+
+import (
+	"net"
+	"strings"
+	"sync"
+)
+
+type ipFilter struct {
+	mutex sync.RWMutex
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+func (filter *ipFilter) setAllowList(cidrs []string) error {
+	networks, err := parseCIDRs(cidrs)
+
+	if err != nil {
+		return err
+	}
+
+	filter.mutex.Lock()
+	filter.allow = networks
+	filter.mutex.Unlock()
+
+	return nil
+}
+
+func (filter *ipFilter) setDenyList(cidrs []string) error {
+	networks, err := parseCIDRs(cidrs)
+
+	if err != nil {
+		return err
+	}
+
+	filter.mutex.Lock()
+	filter.deny = networks
+	filter.mutex.Unlock()
+
+	return nil
+}
+
+// permits checks ip against the lists. Peers without an IP address, such as
+// Unix socket clients, cannot match a deny list and never match an allow list.
+func (filter *ipFilter) permits(ip net.IP) bool {
+	filter.mutex.RLock()
+	defer filter.mutex.RUnlock()
+
+	if ip == nil {
+		return len(filter.allow) == 0
+	}
+
+	if containsIP(filter.deny, ip) {
+		return false
+	}
+
+	return len(filter.allow) == 0 || containsIP(filter.allow, ip)
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: cidr}
+			}
+
+			networks = append(networks, singleIPNet(ip))
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+
+		if err != nil {
+			return nil, err
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func singleIPNet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+func addrIP(address net.Addr) net.IP {
+	switch addr := address.(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	}
+
+	return net.ParseIP(remoteIP(address))
+}
+
+func newIPFilter() *ipFilter {
+	return &ipFilter{}
+}
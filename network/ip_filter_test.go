@@ -0,0 +1,48 @@
+package network
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIPFilterPermits(t *testing.T) {
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		ip    net.IP
+		want  bool
+	}{
+		{"no lists", nil, nil, net.ParseIP("192.0.2.1"), true},
+		{"allowed", []string{"192.0.2.0/24"}, nil, net.ParseIP("192.0.2.1"), true},
+		{"not allowed", []string{"192.0.2.0/24"}, nil, net.ParseIP("198.51.100.1"), false},
+		{"denied", nil, []string{"192.0.2.1"}, net.ParseIP("192.0.2.1"), false},
+		{"deny wins over allow", []string{"192.0.2.0/24"}, []string{"192.0.2.1"}, net.ParseIP("192.0.2.1"), false},
+		{"ipv6 allowed", []string{"2001:db8::/32"}, nil, net.ParseIP("2001:db8::1"), true},
+		{"non-ip peer without lists", nil, nil, nil, true},
+		{"non-ip peer passes deny list", nil, []string{"192.0.2.0/24"}, nil, true},
+		{"non-ip peer fails allow list", []string{"192.0.2.0/24"}, nil, nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter := &ipFilter{}
+
+			err := filter.setAllowList(test.allow)
+
+			if err == nil {
+				err = filter.setDenyList(test.deny)
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := filter.permits(test.ip)
+
+			if got != test.want {
+				t.Fatalf("permits(%v) = %v, want %v", test.ip, got, test.want)
+			}
+		})
+	}
+}
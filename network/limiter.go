@@ -0,0 +1,209 @@
+package network
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type RejectReason int
+
+const (
+	RejectMaxSessions RejectReason = iota + 1
+	RejectMaxSessionsPerIP
+	RejectRateLimited
+	RejectHandshakeFailed
+	RejectDenied
+	RejectFiltered
+)
+
+var rejectReasonNames = map[RejectReason]string{
+	RejectMaxSessions:      "max sessions reached",
+	RejectMaxSessionsPerIP: "max sessions per ip reached",
+	RejectRateLimited:      "accept rate limited",
+	RejectHandshakeFailed:  "handshake failed",
+	RejectDenied:           "address denied",
+	RejectFiltered:         "rejected by filter",
+}
+
+func (reason RejectReason) String() string {
+	name, ok := rejectReasonNames[reason]
+
+	if !ok {
+		return "unknown"
+	}
+
+	return name
+}
+
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (bucket *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(bucket.last).Seconds()
+	bucket.last = now
+	bucket.tokens += elapsed * bucket.rate
+
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+}
+
+func (bucket *tokenBucket) allow(count float64) bool {
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+
+	bucket.refill(time.Now())
+
+	if bucket.tokens < count {
+		return false
+	}
+
+	bucket.tokens -= count
+
+	return true
+}
+
+func (bucket *tokenBucket) refund(count float64) {
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+
+	bucket.tokens += count
+
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+}
+
+func (bucket *tokenBucket) reserve(count float64) time.Duration {
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+
+	bucket.refill(time.Now())
+	bucket.tokens -= count
+
+	if bucket.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = int(rate)
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+type connectionLimiter struct {
+	mutex            sync.Mutex
+	maxSessions      int
+	maxSessionsPerIP int
+	acceptRate       *tokenBucket
+	sessions         int
+	sessionsPerIP    map[string]int
+}
+
+func (limiter *connectionLimiter) admit(ip string) (RejectReason, bool) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	if limiter.acceptRate != nil && !limiter.acceptRate.allow(1) {
+		return RejectRateLimited, false
+	}
+
+	if limiter.maxSessions > 0 && limiter.sessions >= limiter.maxSessions {
+		return RejectMaxSessions, false
+	}
+
+	if ip == "" {
+		limiter.sessions++
+		return 0, true
+	}
+
+	if limiter.maxSessionsPerIP > 0 && limiter.sessionsPerIP[ip] >= limiter.maxSessionsPerIP {
+		return RejectMaxSessionsPerIP, false
+	}
+
+	limiter.sessions++
+	limiter.sessionsPerIP[ip]++
+
+	return 0, true
+}
+
+func (limiter *connectionLimiter) release(ip string) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	limiter.sessions--
+
+	if ip == "" {
+		return
+	}
+
+	limiter.sessionsPerIP[ip]--
+
+	if limiter.sessionsPerIP[ip] <= 0 {
+		delete(limiter.sessionsPerIP, ip)
+	}
+}
+
+// configure changes the limits in place, so that the counts of sessions that
+// are already admitted carry over and are still released correctly.
+func (limiter *connectionLimiter) configure(maxSessions int, maxSessionsPerIP int, acceptRate float64, acceptBurst int) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	limiter.maxSessions = maxSessions
+	limiter.maxSessionsPerIP = maxSessionsPerIP
+	limiter.acceptRate = nil
+
+	if acceptRate > 0 {
+		limiter.acceptRate = newTokenBucket(acceptRate, acceptBurst)
+	}
+}
+
+func newConnectionLimiter() *connectionLimiter {
+	return &connectionLimiter{
+		sessionsPerIP: map[string]int{},
+	}
+}
+
+// remoteIP returns the peer IP of address, or an empty string for peers such
+// as unix sockets that have none and so are exempt from per-IP limits.
+func remoteIP(address net.Addr) string {
+	if address == nil {
+		return ""
+	}
+
+	switch addr := address.(type) {
+	case *net.TCPAddr:
+		return addr.IP.String()
+	case *net.UDPAddr:
+		return addr.IP.String()
+	}
+
+	host, _, err := net.SplitHostPort(address.String())
+
+	if err != nil || net.ParseIP(host) == nil {
+		return ""
+	}
+
+	return host
+}
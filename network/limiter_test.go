@@ -0,0 +1,221 @@
+package network
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startLimitedAcceptor starts an acceptor with settings whose rejections are
+// reported on the returned channel.
+func startLimitedAcceptor(t *testing.T, settings AcceptorSettings) (*Acceptor, string, chan RejectReason) {
+	t.Helper()
+
+	rejected := make(chan RejectReason, 8)
+	settings.OnReject = func(acceptor *Acceptor, remoteAddr net.Addr, reason RejectReason) {
+		rejected <- reason
+	}
+
+	acceptor, address := startTestAcceptor(t, settings)
+
+	return acceptor, address, rejected
+}
+
+func dialTestClient(t *testing.T, address string) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", address)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	return conn
+}
+
+func expectReject(t *testing.T, rejected chan RejectReason, want RejectReason) {
+	t.Helper()
+
+	select {
+	case reason := <-rejected:
+		if reason != want {
+			t.Fatalf("rejected with %v, want %v", reason, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("connection was not rejected, want %v", want)
+	}
+}
+
+func expectNoReject(t *testing.T, rejected chan RejectReason) {
+	t.Helper()
+
+	select {
+	case reason := <-rejected:
+		t.Fatalf("connection was rejected with %v", reason)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAcceptorMaxSessions(t *testing.T) {
+	acceptor, address, rejected := startLimitedAcceptor(t, AcceptorSettings{MaxSessions: 2})
+
+	dialTestClient(t, address)
+	second := dialTestClient(t, address)
+	expectNoReject(t, rejected)
+
+	dialTestClient(t, address)
+	expectReject(t, rejected, RejectMaxSessions)
+
+	second.Close()
+
+	ok := waitUntil(t, func() bool {
+		return acceptor.Stats().Active == 1
+	})
+
+	if !ok {
+		t.Fatal("session was not released after the client disconnected")
+	}
+
+	dialTestClient(t, address)
+	expectNoReject(t, rejected)
+
+	if acceptor.Stats().Rejected != 1 {
+		t.Fatalf("Rejected = %d, want 1", acceptor.Stats().Rejected)
+	}
+}
+
+func TestAcceptorMaxSessionsPerIP(t *testing.T) {
+	_, address, rejected := startLimitedAcceptor(t, AcceptorSettings{MaxSessionsPerIP: 1})
+
+	dialTestClient(t, address)
+	expectNoReject(t, rejected)
+
+	dialTestClient(t, address)
+	expectReject(t, rejected, RejectMaxSessionsPerIP)
+}
+
+func TestAcceptorAcceptRate(t *testing.T) {
+	_, address, rejected := startLimitedAcceptor(t, AcceptorSettings{AcceptRate: 1, AcceptBurst: 1})
+
+	dialTestClient(t, address)
+	expectNoReject(t, rejected)
+
+	dialTestClient(t, address)
+	expectReject(t, rejected, RejectRateLimited)
+}
+
+func TestAcceptorOnAcceptRejectsAsFiltered(t *testing.T) {
+	_, address, rejected := startLimitedAcceptor(t, AcceptorSettings{
+		OnAccept: func(remoteAddr net.Addr) bool {
+			return false
+		},
+	})
+
+	dialTestClient(t, address)
+	expectReject(t, rejected, RejectFiltered)
+}
+
+func TestLimiterConfigureKeepsCounts(t *testing.T) {
+	limiter := newConnectionLimiter()
+	limiter.configure(2, 0, 0, 0)
+
+	for i := 0; i < 2; i++ {
+		_, ok := limiter.admit("10.0.0.1")
+
+		if !ok {
+			t.Fatal("session under the limit was rejected")
+		}
+	}
+
+	limiter.configure(2, 2, 0, 0)
+	reason, ok := limiter.admit("10.0.0.2")
+
+	if ok || reason != RejectMaxSessions {
+		t.Fatalf("admit after reconfiguring = %v, %v, want %v", reason, ok, RejectMaxSessions)
+	}
+
+	limiter.release("10.0.0.1")
+	reason, ok = limiter.admit("10.0.0.1")
+
+	if !ok {
+		t.Fatalf("admit after a release = %v, want admitted", reason)
+	}
+
+	reason, ok = limiter.admit("10.0.0.2")
+
+	if ok || reason != RejectMaxSessions {
+		t.Fatalf("admit over the limit = %v, %v, want %v", reason, ok, RejectMaxSessions)
+	}
+}
+
+func TestRemoteIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		address net.Addr
+		want    string
+	}{
+		{"tcp", &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 80}, "192.0.2.1"},
+		{"udp", &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 53}, "2001:db8::1"},
+		{"unix", &net.UnixAddr{Name: "@", Net: "unix"}, ""},
+		{"host and port", fakeAddr{network: "custom", address: "198.51.100.7:9000"}, "198.51.100.7"},
+		{"no ip", fakeAddr{network: "pipe", address: "pipe"}, ""},
+		{"nil", nil, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := remoteIP(test.address)
+
+			if got != test.want {
+				t.Fatalf("remoteIP(%v) = %q, want %q", test.address, got, test.want)
+			}
+		})
+	}
+}
+
+func TestAcceptorUnixSocketSkipsPerIPLimit(t *testing.T) {
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "acceptor.sock"))
+
+	if err != nil {
+		t.Skip("unix sockets are not supported: ", err)
+	}
+
+	rejected := make(chan RejectReason, 8)
+	acceptor := NewAcceptor(AcceptorSettings{
+		MaxSessionsPerIP: 1,
+		OnReject: func(acceptor *Acceptor, remoteAddr net.Addr, reason RejectReason) {
+			rejected <- reason
+		},
+	})
+
+	if !acceptor.Serve(listener) {
+		t.Fatal("acceptor failed to serve")
+	}
+
+	defer acceptor.Stop()
+
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("unix", listener.Addr().String())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer conn.Close()
+	}
+
+	ok := waitUntil(t, func() bool {
+		return acceptor.Stats().Active == 3
+	})
+
+	if !ok {
+		t.Fatalf("Active = %d with three unix clients, want 3", acceptor.Stats().Active)
+	}
+
+	expectNoReject(t, rejected)
+}
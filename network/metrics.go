@@ -0,0 +1,348 @@
+package network
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	defaultFrameSizeBuckets      = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+	defaultHandlerLatencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+)
+
+type metricsGaugeFunc func() float64
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     uint64
+	scale   float64
+}
+
+func (h *histogram) observe(value uint64) {
+	scaled := float64(value) / h.scale
+
+	for i, bound := range h.buckets {
+		if scaled <= bound {
+			atomic.AddUint64(&h.counts[i], 1)
+		}
+	}
+
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddUint64(&h.sum, value)
+}
+
+func (h *histogram) write(writer io.Writer, name string, labels string) {
+	separator := ""
+
+	if labels != "" {
+		separator = ","
+	}
+
+	for i, bound := range h.buckets {
+		fmt.Fprintf(writer, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, separator,
+			formatFloat(bound), atomic.LoadUint64(&h.counts[i]))
+	}
+
+	count := atomic.LoadUint64(&h.count)
+	fmt.Fprintf(writer, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, separator, count)
+	fmt.Fprintf(writer, "%s_sum%s %s\n", name, wrapLabels(labels), formatFloat(float64(atomic.LoadUint64(&h.sum))/h.scale))
+	fmt.Fprintf(writer, "%s_count%s %d\n", name, wrapLabels(labels), count)
+}
+
+func newHistogram(buckets []float64, scale float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+		scale:   scale,
+	}
+}
+
+type metricsGauge struct {
+	kind  string
+	help  string
+	value metricsGaugeFunc
+}
+
+type Metrics struct {
+	mutex      sync.RWMutex
+	acceptors  map[string]*Acceptor
+	connectors map[string]*Connector
+	gauges     map[string]metricsGauge
+
+	frameSizeIn    *histogram
+	frameSizeOut   *histogram
+	handlerLatency *histogram
+}
+
+func (metrics *Metrics) RegisterAcceptor(name string, acceptor *Acceptor) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	acceptor.setMetrics(metrics)
+	metrics.acceptors[name] = acceptor
+}
+
+func (metrics *Metrics) RegisterConnector(name string, connector *Connector) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	connector.setMetrics(metrics)
+	metrics.connectors[name] = connector
+}
+
+func (metrics *Metrics) RegisterGauge(name string, help string, value metricsGaugeFunc) {
+	metrics.registerValue(name, "gauge", help, value)
+}
+
+// RegisterCounter exports a monotonically increasing value. By convention the
+// name should end in _total.
+func (metrics *Metrics) RegisterCounter(name string, help string, value metricsGaugeFunc) {
+	metrics.registerValue(name, "counter", help, value)
+}
+
+func (metrics *Metrics) registerValue(name string, kind string, help string, value metricsGaugeFunc) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	metrics.gauges[name] = metricsGauge{
+		kind:  kind,
+		help:  help,
+		value: value,
+	}
+}
+
+func (metrics *Metrics) Unregister(name string) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	delete(metrics.acceptors, name)
+	delete(metrics.connectors, name)
+	delete(metrics.gauges, name)
+}
+
+func (metrics *Metrics) observeFrameIn(size int) {
+	metrics.frameSizeIn.observe(uint64(size))
+}
+
+func (metrics *Metrics) observeFrameOut(size int) {
+	metrics.frameSizeOut.observe(uint64(size))
+}
+
+func (metrics *Metrics) observeHandler(duration time.Duration) {
+	metrics.handlerLatency.observe(uint64(duration))
+}
+
+func (metrics *Metrics) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WriteTo(writer)
+}
+
+func (metrics *Metrics) WriteTo(w io.Writer) (int64, error) {
+	counter := &countingWriter{writer: w}
+	writer := bufio.NewWriter(counter)
+
+	metrics.mutex.RLock()
+	metrics.writeAcceptors(writer)
+	metrics.writeConnectors(writer)
+	metrics.writeGauges(writer)
+	metrics.mutex.RUnlock()
+
+	writeHeader(writer, "go_network_frame_size_bytes", "histogram", "Size of framed packets in bytes.")
+	metrics.frameSizeIn.write(writer, "go_network_frame_size_bytes", `direction="in"`)
+	metrics.frameSizeOut.write(writer, "go_network_frame_size_bytes", `direction="out"`)
+	writeHeader(writer, "go_network_handler_duration_seconds", "histogram", "Time spent in packet handlers.")
+	metrics.handlerLatency.write(writer, "go_network_handler_duration_seconds", "")
+
+	err := writer.Flush()
+
+	return counter.size, err
+}
+
+func (metrics *Metrics) writeAcceptors(writer io.Writer) {
+	names := sortedKeys(len(metrics.acceptors), func(keys []string) []string {
+		for name := range metrics.acceptors {
+			keys = append(keys, name)
+		}
+
+		return keys
+	})
+
+	if len(names) == 0 {
+		return
+	}
+
+	stats := make([]AcceptorStats, len(names))
+
+	for i, name := range names {
+		stats[i] = metrics.acceptors[name].Stats()
+	}
+
+	writeHeader(writer, "go_network_acceptor_active_sessions", "gauge", "Number of live sessions.")
+
+	for i, name := range names {
+		fmt.Fprintf(writer, "go_network_acceptor_active_sessions{acceptor=\"%s\"} %d\n", escapeLabelValue(name), stats[i].Active)
+	}
+
+	writeHeader(writer, "go_network_acceptor_accepted_total", "counter", "Connections accepted.")
+
+	for i, name := range names {
+		fmt.Fprintf(writer, "go_network_acceptor_accepted_total{acceptor=\"%s\"} %d\n", escapeLabelValue(name), stats[i].Accepted)
+	}
+
+	writeHeader(writer, "go_network_acceptor_rejected_total", "counter", "Connections rejected.")
+
+	for i, name := range names {
+		fmt.Fprintf(writer, "go_network_acceptor_rejected_total{acceptor=\"%s\"} %d\n", escapeLabelValue(name), stats[i].Rejected)
+	}
+
+	writeHeader(writer, "go_network_acceptor_bytes_total", "counter", "Bytes transferred by accepted sessions.")
+
+	for i, name := range names {
+		fmt.Fprintf(writer, "go_network_acceptor_bytes_total{acceptor=\"%s\",direction=\"in\"} %d\n", escapeLabelValue(name), stats[i].BytesIn)
+		fmt.Fprintf(writer, "go_network_acceptor_bytes_total{acceptor=\"%s\",direction=\"out\"} %d\n", escapeLabelValue(name), stats[i].BytesOut)
+	}
+
+	writeHeader(writer, "go_network_acceptor_packets_total", "counter", "Packets transferred by accepted sessions.")
+
+	for i, name := range names {
+		fmt.Fprintf(writer, "go_network_acceptor_packets_total{acceptor=\"%s\",direction=\"in\"} %d\n", escapeLabelValue(name), stats[i].PacketsIn)
+		fmt.Fprintf(writer, "go_network_acceptor_packets_total{acceptor=\"%s\",direction=\"out\"} %d\n", escapeLabelValue(name), stats[i].PacketsOut)
+	}
+}
+
+func (metrics *Metrics) writeConnectors(writer io.Writer) {
+	names := sortedKeys(len(metrics.connectors), func(keys []string) []string {
+		for name := range metrics.connectors {
+			keys = append(keys, name)
+		}
+
+		return keys
+	})
+
+	if len(names) == 0 {
+		return
+	}
+
+	stats := make([]ConnectorStats, len(names))
+
+	for i, name := range names {
+		stats[i] = metrics.connectors[name].Stats()
+	}
+
+	writeHeader(writer, "go_network_connector_connected", "gauge", "Whether the connector link is up.")
+
+	for i, name := range names {
+		connected := 0
+
+		if stats[i].State == ConnectorConnected {
+			connected = 1
+		}
+
+		fmt.Fprintf(writer, "go_network_connector_connected{connector=\"%s\"} %d\n", escapeLabelValue(name), connected)
+	}
+
+	writeHeader(writer, "go_network_connector_reconnect_attempts_total", "counter", "Reconnect attempts made.")
+
+	for i, name := range names {
+		fmt.Fprintf(writer, "go_network_connector_reconnect_attempts_total{connector=\"%s\"} %d\n", escapeLabelValue(name), stats[i].ReconnectAttempts)
+	}
+
+	writeHeader(writer, "go_network_connector_bytes_total", "counter", "Bytes transferred by the connector.")
+
+	for i, name := range names {
+		fmt.Fprintf(writer, "go_network_connector_bytes_total{connector=\"%s\",direction=\"in\"} %d\n", escapeLabelValue(name), stats[i].BytesIn)
+		fmt.Fprintf(writer, "go_network_connector_bytes_total{connector=\"%s\",direction=\"out\"} %d\n", escapeLabelValue(name), stats[i].BytesOut)
+	}
+
+	writeHeader(writer, "go_network_connector_packets_total", "counter", "Packets transferred by the connector.")
+
+	for i, name := range names {
+		fmt.Fprintf(writer, "go_network_connector_packets_total{connector=\"%s\",direction=\"in\"} %d\n", escapeLabelValue(name), stats[i].PacketsIn)
+		fmt.Fprintf(writer, "go_network_connector_packets_total{connector=\"%s\",direction=\"out\"} %d\n", escapeLabelValue(name), stats[i].PacketsOut)
+	}
+}
+
+func (metrics *Metrics) writeGauges(writer io.Writer) {
+	names := sortedKeys(len(metrics.gauges), func(keys []string) []string {
+		for name := range metrics.gauges {
+			keys = append(keys, name)
+		}
+
+		return keys
+	})
+
+	for _, name := range names {
+		gauge := metrics.gauges[name]
+		writeHeader(writer, name, gauge.kind, gauge.help)
+		fmt.Fprintf(writer, "%s %s\n", name, formatFloat(gauge.value()))
+	}
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		acceptors:      map[string]*Acceptor{},
+		connectors:     map[string]*Connector{},
+		gauges:         map[string]metricsGauge{},
+		frameSizeIn:    newHistogram(defaultFrameSizeBuckets, 1),
+		frameSizeOut:   newHistogram(defaultFrameSizeBuckets, 1),
+		handlerLatency: newHistogram(defaultHandlerLatencyBuckets, float64(time.Second)),
+	}
+}
+
+type countingWriter struct {
+	writer io.Writer
+	size   int64
+}
+
+func (writer *countingWriter) Write(data []byte) (int, error) {
+	size, err := writer.writer.Write(data)
+	writer.size += int64(size)
+
+	return size, err
+}
+
+func writeHeader(writer io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabelValue applies the text exposition format escaping for label
+// values, which only covers backslash, double quote and line feed.
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+
+	return "{" + labels + "}"
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func sortedKeys(size int, collect func(keys []string) []string) []string {
+	keys := collect(make([]string, 0, size))
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,109 @@
+package network
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestEscapeLabelValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"plain", "plain"},
+		{`back\slash`, `back\\slash`},
+		{`say "hi"`, `say \"hi\"`},
+		{"two\nlines", `two\nlines`},
+		{"tab\tand ünicode", "tab\tand ünicode"},
+	}
+
+	for _, test := range tests {
+		got := escapeLabelValue(test.value)
+
+		if got != test.want {
+			t.Errorf("escapeLabelValue(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestMetricsWriteEscapesLabels(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.RegisterConnector("edge \"eu\"\tü", NewConnector(ConnectorSettings{}))
+
+	var output bytes.Buffer
+
+	_, err := metrics.WriteTo(&output)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "go_network_connector_connected{connector=\"edge \\\"eu\\\"\tü\"} 0\n"
+
+	if !strings.Contains(output.String(), want) {
+		t.Fatalf("output does not contain %q:\n%s", want, output.String())
+	}
+}
+
+func TestMetricsWriteRegisteredValueTypes(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.RegisterGauge("test_gauge", "A gauge.", func() float64 {
+		return 1.5
+	})
+	metrics.RegisterCounter("test_events_total", "A counter.", func() float64 {
+		return 3
+	})
+
+	var output bytes.Buffer
+
+	_, err := metrics.WriteTo(&output)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"# TYPE test_gauge gauge\ntest_gauge 1.5\n",
+		"# TYPE test_events_total counter\ntest_events_total 3\n",
+	} {
+		if !strings.Contains(output.String(), want) {
+			t.Fatalf("output does not contain %q:\n%s", want, output.String())
+		}
+	}
+}
+
+func TestRegisterAcceptorWhileAccepting(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acceptor := NewAcceptor(AcceptorSettings{})
+	acceptor.Serve(listener)
+	defer acceptor.Stop()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 20; i++ {
+			conn, err := net.Dial("tcp", listener.Addr().String())
+
+			if err != nil {
+				return
+			}
+
+			conn.Close()
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		NewMetrics().RegisterAcceptor("acceptor", acceptor)
+	}
+
+	<-done
+}
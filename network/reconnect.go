@@ -0,0 +1,79 @@
+package network
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultReconnectInitialDelay = time.Second
+	defaultReconnectMultiplier   = 2.0
+	defaultReconnectMaxDelay     = time.Minute
+)
+
+type ReconnectSettings struct {
+	Enable       bool
+	InitialDelay time.Duration
+	Multiplier   float64
+	MaxDelay     time.Duration
+	Jitter       float64
+	MaxAttempts  int
+}
+
+type backoff struct {
+	settings ReconnectSettings
+	delay    time.Duration
+	attempts int
+}
+
+func (b *backoff) next() (time.Duration, bool) {
+	if b.settings.MaxAttempts > 0 && b.attempts >= b.settings.MaxAttempts {
+		return 0, false
+	}
+
+	if b.attempts == 0 {
+		b.delay = b.settings.InitialDelay
+	} else {
+		b.delay = time.Duration(float64(b.delay) * b.settings.Multiplier)
+	}
+
+	if b.delay > b.settings.MaxDelay {
+		b.delay = b.settings.MaxDelay
+	}
+
+	b.attempts++
+	delay := b.delay
+
+	if b.settings.Jitter > 0 {
+		delta := float64(delay) * b.settings.Jitter
+		delay += time.Duration(delta * (rand.Float64()*2 - 1))
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+
+	return delay, true
+}
+
+func newBackoff(settings ReconnectSettings) *backoff {
+	if settings.InitialDelay <= 0 {
+		settings.InitialDelay = defaultReconnectInitialDelay
+	}
+
+	if settings.Multiplier < 1 {
+		settings.Multiplier = defaultReconnectMultiplier
+	}
+
+	if settings.MaxDelay <= 0 {
+		settings.MaxDelay = defaultReconnectMaxDelay
+	}
+
+	if settings.Jitter > 1 {
+		settings.Jitter = 1
+	}
+
+	return &backoff{
+		settings: settings,
+	}
+}
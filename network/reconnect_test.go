@@ -0,0 +1,125 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffBounds(t *testing.T) {
+	b := newBackoff(ReconnectSettings{
+		InitialDelay: time.Millisecond * 100,
+		Multiplier:   2,
+		MaxDelay:     time.Millisecond * 500,
+		MaxAttempts:  6,
+	})
+	want := []time.Duration{100, 200, 400, 500, 500, 500}
+
+	for i, delay := range want {
+		got, ok := b.next()
+
+		if !ok || got != delay*time.Millisecond {
+			t.Fatalf("attempt %d: delay %v, %v, want %v", i, got, ok, delay*time.Millisecond)
+		}
+	}
+
+	_, ok := b.next()
+
+	if ok {
+		t.Fatal("backoff continued past MaxAttempts")
+	}
+}
+
+func TestBackoffJitterStaysInRange(t *testing.T) {
+	b := newBackoff(ReconnectSettings{
+		InitialDelay: time.Second,
+		Multiplier:   1,
+		Jitter:       0.25,
+	})
+
+	for i := 0; i < 1000; i++ {
+		delay, _ := b.next()
+
+		if delay < time.Millisecond*750 || delay > time.Millisecond*1250 {
+			t.Fatalf("jittered delay %v outside [750ms, 1250ms]", delay)
+		}
+	}
+}
+
+func TestBackoffDefaults(t *testing.T) {
+	b := newBackoff(ReconnectSettings{})
+	first, _ := b.next()
+	second, _ := b.next()
+
+	if first != defaultReconnectInitialDelay || second != defaultReconnectInitialDelay*2 {
+		t.Fatalf("default delays %v, %v, want %v, %v", first, second,
+			defaultReconnectInitialDelay, defaultReconnectInitialDelay*2)
+	}
+}
+
+func TestConnectorReconnectsAfterPeerDrops(t *testing.T) {
+	accepted := make(chan *Session, 4)
+	_, address := startTestAcceptor(t, AcceptorSettings{
+		OnNewSession: func(acceptor *Acceptor, session *Session) {
+			accepted <- session
+		},
+	})
+
+	connected := make(chan struct{}, 4)
+	disconnected := make(chan DisconnectReason, 4)
+	connector := NewConnector(ConnectorSettings{
+		OnConnected: func(connector *Connector) {
+			connected <- struct{}{}
+		},
+		OnDisconnected: func(connector *Connector, session *Session, reason DisconnectReason) {
+			disconnected <- reason
+		},
+		ReconnectSettings: ReconnectSettings{
+			Enable:       true,
+			InitialDelay: time.Millisecond * 10,
+		},
+	})
+
+	if !connector.DialNetwork("tcp", address) {
+		t.Fatal("connect failed")
+	}
+
+	connector.Start()
+	defer connector.Stop()
+
+	timeout := time.After(time.Second * 5)
+	var first *Session
+
+	select {
+	case first = <-accepted:
+	case <-timeout:
+		t.Fatal("acceptor did not see the first connection")
+	}
+
+	first.Stop()
+
+	select {
+	case <-disconnected:
+	case <-timeout:
+		t.Fatal("connector did not notice the dropped connection")
+	}
+
+	select {
+	case <-accepted:
+	case <-timeout:
+		t.Fatal("connector did not reconnect")
+	}
+
+	<-connected
+
+	select {
+	case <-connected:
+	case <-timeout:
+		t.Fatal("OnConnected did not fire for the reconnect")
+	}
+
+	stats := connector.Stats()
+
+	if stats.Connects != 2 || stats.ReconnectAttempts == 0 {
+		t.Fatalf("connects %d, reconnect attempts %d, want 2 and at least 1", stats.Connects, stats.ReconnectAttempts)
+	}
+}
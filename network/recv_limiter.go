@@ -0,0 +1,142 @@
+package network
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type RateLimitPolicy int
+
+const (
+	RateLimitDelay RateLimitPolicy = iota
+	RateLimitDrop
+	RateLimitDisconnect
+)
+
+// RecvRateLimitSettings bounds how fast a session accepts inbound packets.
+// A zero rate leaves that dimension unlimited, and each burst defaults to one
+// second's worth of its rate. Under RateLimitDrop a packet larger than
+// ByteBurst can never pass, so size ByteBurst to at least MaxRecvBuffSize.
+type RecvRateLimitSettings struct {
+	Enable           bool
+	PacketsPerSecond float64
+	PacketBurst      int
+	BytesPerSecond   float64
+	ByteBurst        int
+	Policy           RateLimitPolicy
+}
+
+type recvLimiter struct {
+	packets *tokenBucket
+	bytes   *tokenBucket
+	policy  RateLimitPolicy
+}
+
+func (limiter *recvLimiter) allow(size int) bool {
+	if limiter.packets != nil && !limiter.packets.allow(1) {
+		return false
+	}
+
+	if limiter.bytes != nil && !limiter.bytes.allow(float64(size)) {
+		if limiter.packets != nil {
+			limiter.packets.refund(1)
+		}
+
+		return false
+	}
+
+	return true
+}
+
+func (limiter *recvLimiter) reserve(size int) time.Duration {
+	var delay time.Duration
+
+	if limiter.packets != nil {
+		delay = limiter.packets.reserve(1)
+	}
+
+	if limiter.bytes != nil {
+		bytesDelay := limiter.bytes.reserve(float64(size))
+
+		if bytesDelay > delay {
+			delay = bytesDelay
+		}
+	}
+
+	return delay
+}
+
+func newRecvLimiter(settings RecvRateLimitSettings) *recvLimiter {
+	if !settings.Enable {
+		return nil
+	}
+
+	limiter := &recvLimiter{
+		policy: settings.Policy,
+	}
+
+	if settings.PacketsPerSecond > 0 {
+		limiter.packets = newTokenBucket(settings.PacketsPerSecond, settings.PacketBurst)
+	}
+
+	if settings.BytesPerSecond > 0 {
+		limiter.bytes = newTokenBucket(settings.BytesPerSecond, settings.ByteBurst)
+	}
+
+	if limiter.packets == nil && limiter.bytes == nil {
+		return nil
+	}
+
+	return limiter
+}
+
+func (session *Session) limitRecvRate(size int) (bool, error) {
+	limiter := session.recvLimiter
+
+	if limiter == nil {
+		return true, nil
+	}
+
+	if limiter.policy == RateLimitDelay {
+		delay := limiter.reserve(size)
+
+		if delay <= 0 {
+			return true, nil
+		}
+
+		atomic.AddUint64(&session.stats.rateLimitedPackets, 1)
+		session.OnRateLimited(session, size, limiter.policy)
+
+		return session.waitRecvDelay(delay), nil
+	}
+
+	if limiter.allow(size) {
+		return true, nil
+	}
+
+	atomic.AddUint64(&session.stats.rateLimitedPackets, 1)
+	session.OnRateLimited(session, size, limiter.policy)
+
+	if limiter.policy == RateLimitDisconnect {
+		return false, ErrRateLimited
+	}
+
+	return false, nil
+}
+
+// waitRecvDelay reports whether a delayed packet should still be delivered. A
+// graceful close cuts the delay short but delivers the packet, which has been
+// fully received; only Stop drops it.
+func (session *Session) waitRecvDelay(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-session.stop:
+		return false
+	case <-session.closing:
+		return !session.isStopped()
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,159 @@
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// newRateLimitedSession starts a pipe session with limit and reports every
+// delivered packet on the returned channel.
+func newRateLimitedSession(t *testing.T, limit RecvRateLimitSettings) (*Session, net.Conn, chan []byte) {
+	t.Helper()
+
+	delivered := make(chan []byte, 8)
+	session, peer := newPipeSession(t, SessionSettings{
+		RecvRateLimit: limit,
+		OnRead: func(session *Session, data []byte, size int) {
+			delivered <- append([]byte(nil), data...)
+		},
+	})
+
+	return session, peer, delivered
+}
+
+func writeTestPackets(peer net.Conn, count int) {
+	go func() {
+		for i := 0; i < count; i++ {
+			_, err := peer.Write(buildPacket([]byte{byte(i)}))
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func receiveTestPacket(t *testing.T, delivered chan []byte, timeout time.Duration) []byte {
+	t.Helper()
+
+	select {
+	case packet := <-delivered:
+		return packet
+	case <-time.After(timeout):
+		t.Fatal("packet was not delivered")
+		return nil
+	}
+}
+
+func TestRecvRateLimitDelay(t *testing.T) {
+	session, peer, delivered := newRateLimitedSession(t, RecvRateLimitSettings{
+		Enable:           true,
+		PacketsPerSecond: 20,
+		PacketBurst:      1,
+		Policy:           RateLimitDelay,
+	})
+
+	start := time.Now()
+	writeTestPackets(peer, 3)
+
+	for i := 0; i < 3; i++ {
+		packet := receiveTestPacket(t, delivered, time.Second)
+
+		if packet[0] != byte(i) {
+			t.Fatalf("packet %d delivered out of order as %d", i, packet[0])
+		}
+	}
+
+	elapsed := time.Since(start)
+
+	if elapsed < 80*time.Millisecond {
+		t.Fatalf("3 packets at 20 per second took %v, want them delayed", elapsed)
+	}
+
+	if session.Stats().RateLimitedPackets != 2 || session.isStopped() {
+		t.Fatalf("RateLimitedPackets = %d, stopped = %v, want 2 delayed packets on a live session",
+			session.Stats().RateLimitedPackets, session.isStopped())
+	}
+}
+
+func TestRecvRateLimitDrop(t *testing.T) {
+	session, peer, delivered := newRateLimitedSession(t, RecvRateLimitSettings{
+		Enable:           true,
+		PacketsPerSecond: 1,
+		PacketBurst:      1,
+		Policy:           RateLimitDrop,
+	})
+
+	writeTestPackets(peer, 3)
+	receiveTestPacket(t, delivered, time.Second)
+
+	ok := waitUntil(t, func() bool {
+		return session.Stats().RateLimitedPackets == 2
+	})
+
+	if !ok {
+		t.Fatalf("RateLimitedPackets = %d, want 2", session.Stats().RateLimitedPackets)
+	}
+
+	select {
+	case packet := <-delivered:
+		t.Fatalf("dropped packet %d was delivered", packet[0])
+	default:
+	}
+
+	if session.isStopped() {
+		t.Fatal("dropping packets stopped the session")
+	}
+}
+
+func TestRecvRateLimitDisconnect(t *testing.T) {
+	session, peer, delivered := newRateLimitedSession(t, RecvRateLimitSettings{
+		Enable:           true,
+		PacketsPerSecond: 1,
+		PacketBurst:      1,
+		Policy:           RateLimitDisconnect,
+	})
+
+	writeTestPackets(peer, 2)
+	receiveTestPacket(t, delivered, time.Second)
+
+	select {
+	case <-session.Done():
+	case <-time.After(time.Second):
+		t.Fatal("session was not disconnected")
+	}
+
+	reason := session.GetDisconnectReason()
+
+	if reason.Err != ErrRateLimited || reason.Code != DisconnectRateLimited {
+		t.Fatalf("disconnect reason = %v, want %v", reason, NewDisconnectReason(ErrRateLimited))
+	}
+}
+
+func TestRecvRateLimitDelayDeliversOnClose(t *testing.T) {
+	session, peer, delivered := newRateLimitedSession(t, RecvRateLimitSettings{
+		Enable:           true,
+		PacketsPerSecond: 0.5,
+		PacketBurst:      1,
+		Policy:           RateLimitDelay,
+	})
+
+	writeTestPackets(peer, 2)
+	receiveTestPacket(t, delivered, time.Second)
+
+	ok := waitUntil(t, func() bool {
+		return session.Stats().RateLimitedPackets == 1
+	})
+
+	if !ok {
+		t.Fatal("second packet was not delayed")
+	}
+
+	session.Close(ErrLocalClose)
+	packet := receiveTestPacket(t, delivered, 500*time.Millisecond)
+
+	if packet[0] != 1 {
+		t.Fatalf("delivered packet %d on close, want 1", packet[0])
+	}
+}
@@ -0,0 +1,601 @@
+package network
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultReliableUDPMTU          = 1400
+	defaultReliableUDPInterval     = time.Millisecond * 10
+	defaultReliableUDPWindow       = 128
+	defaultReliableUDPMinRTO       = time.Millisecond * 100
+	defaultReliableUDPFastResend   = 2
+	defaultReliableUDPDeadLink     = 10
+	defaultReliableUDPDialTimeout  = time.Second * 5
+	defaultReliableUDPCloseTimeout = time.Second * 3
+	defaultReliableUDPBacklog      = 128
+	minReliableUDPMTU              = arqHeaderSize + 1
+)
+
+type Transport int
+
+const (
+	TransportTCP Transport = iota
+	TransportReliableUDP
+)
+
+// ReliableUDPSettings tunes the ARQ protocol behind TransportReliableUDP.
+// Windows are counted in segments of up to MTU bytes. FastResend is the number
+// of later acknowledgements that trigger an early retransmission; a negative
+// value disables fast retransmission. DeadLink is the number of transmissions
+// of one segment after which the peer is considered unreachable; with the
+// defaults that takes about 25 seconds. NoCongestionControl trades fairness
+// for latency and suits small real-time messages on lossy links.
+type ReliableUDPSettings struct {
+	MTU                 int
+	Interval            time.Duration
+	SendWindow          int
+	RecvWindow          int
+	MinRTO              time.Duration
+	FastResend          int
+	NoCongestionControl bool
+	DeadLink            int
+	DialTimeout         time.Duration
+	CloseTimeout        time.Duration
+	AcceptBacklog       int
+}
+
+func (settings *ReliableUDPSettings) setDefaults() {
+	if settings.MTU <= 0 {
+		settings.MTU = defaultReliableUDPMTU
+	}
+
+	if settings.MTU < minReliableUDPMTU {
+		settings.MTU = minReliableUDPMTU
+	}
+
+	if settings.MTU > maxDatagramSize {
+		settings.MTU = maxDatagramSize
+	}
+
+	if settings.Interval <= 0 {
+		settings.Interval = defaultReliableUDPInterval
+	}
+
+	if settings.SendWindow <= 0 {
+		settings.SendWindow = defaultReliableUDPWindow
+	}
+
+	if settings.RecvWindow <= 0 {
+		settings.RecvWindow = defaultReliableUDPWindow
+	}
+
+	if settings.MinRTO <= 0 {
+		settings.MinRTO = defaultReliableUDPMinRTO
+	}
+
+	if settings.FastResend == 0 {
+		settings.FastResend = defaultReliableUDPFastResend
+	}
+
+	if settings.FastResend < 0 {
+		settings.FastResend = 0
+	}
+
+	if settings.DeadLink <= 0 {
+		settings.DeadLink = defaultReliableUDPDeadLink
+	}
+
+	if settings.DialTimeout <= 0 {
+		settings.DialTimeout = defaultReliableUDPDialTimeout
+	}
+
+	if settings.CloseTimeout <= 0 {
+		settings.CloseTimeout = defaultReliableUDPCloseTimeout
+	}
+
+	if settings.AcceptBacklog <= 0 {
+		settings.AcceptBacklog = defaultReliableUDPBacklog
+	}
+}
+
+// reliableUDPConn is an ordered, reliable byte stream carried over UDP. It
+// implements net.Conn so that Session framing works on top of it unchanged.
+type reliableUDPConn struct {
+	mutex       sync.Mutex
+	arq         *arq
+	settings    ReliableUDPSettings
+	localAddr   net.Addr
+	remoteAddr  net.Addr
+	write       func(datagram []byte)
+	onRelease   func(conn *reliableUDPConn)
+	readable    chan struct{}
+	writable    chan struct{}
+	established chan struct{}
+	isOpen      bool
+	closed      chan struct{}
+	closeOnce   sync.Once
+	released    chan struct{}
+	releaseOnce sync.Once
+	lingerUntil time.Time
+
+	readDeadline  *connDeadline
+	writeDeadline *connDeadline
+}
+
+func (conn *reliableUDPConn) run() {
+	ticker := time.NewTicker(conn.settings.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-conn.released:
+			return
+		case <-ticker.C:
+			conn.update()
+		}
+	}
+}
+
+func (conn *reliableUDPConn) update() {
+	conn.mutex.Lock()
+	conn.arq.flush()
+	dead := conn.arq.dead
+	drained := conn.arq.waitSnd() == 0
+	lingerUntil := conn.lingerUntil
+	conn.mutex.Unlock()
+
+	if dead {
+		conn.notify()
+	}
+
+	if lingerUntil.IsZero() {
+		return
+	}
+
+	if dead || drained || time.Now().After(lingerUntil) {
+		conn.release()
+	}
+}
+
+func (conn *reliableUDPConn) input(datagram []byte) {
+	conn.mutex.Lock()
+	conn.arq.input(datagram)
+
+	if !conn.isOpen && conn.arq.sndUna > 0 {
+		conn.isOpen = true
+		close(conn.established)
+	}
+
+	conn.mutex.Unlock()
+	conn.notify()
+}
+
+func (conn *reliableUDPConn) notify() {
+	select {
+	case conn.readable <- struct{}{}:
+	default:
+	}
+
+	select {
+	case conn.writable <- struct{}{}:
+	default:
+	}
+}
+
+func (conn *reliableUDPConn) output(datagram []byte) {
+	select {
+	case <-conn.released:
+		return
+	default:
+	}
+
+	conn.write(datagram)
+}
+
+func (conn *reliableUDPConn) Read(data []byte) (int, error) {
+	for {
+		conn.mutex.Lock()
+		size, eof := conn.arq.recv(data)
+		dead := conn.arq.dead
+		conn.mutex.Unlock()
+
+		if size > 0 {
+			return size, nil
+		}
+
+		if eof {
+			return 0, io.EOF
+		}
+
+		if dead {
+			return 0, ErrPeerUnreachable
+		}
+
+		select {
+		case <-conn.readable:
+		case <-conn.closed:
+			return 0, net.ErrClosed
+		case <-conn.readDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+func (conn *reliableUDPConn) Write(data []byte) (int, error) {
+	for {
+		select {
+		case <-conn.closed:
+			return 0, net.ErrClosed
+		default:
+		}
+
+		conn.mutex.Lock()
+		dead := conn.arq.dead
+		full := conn.arq.waitSnd() >= 2*conn.settings.SendWindow
+
+		if !dead && !full {
+			conn.arq.send(data)
+			conn.arq.flush()
+		}
+
+		conn.mutex.Unlock()
+
+		if dead {
+			return 0, ErrPeerUnreachable
+		}
+
+		if !full {
+			return len(data), nil
+		}
+
+		select {
+		case <-conn.writable:
+		case <-conn.closed:
+			return 0, net.ErrClosed
+		case <-conn.writeDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+// Close sends a fin after any queued data and returns immediately. The
+// connection keeps retransmitting in the background until the peer has
+// acknowledged everything or CloseTimeout passes.
+func (conn *reliableUDPConn) Close() error {
+	conn.closeOnce.Do(func() {
+		close(conn.closed)
+
+		conn.mutex.Lock()
+		conn.arq.sendControl(arqCmdFin)
+		conn.arq.flush()
+		conn.lingerUntil = time.Now().Add(conn.settings.CloseTimeout)
+		conn.mutex.Unlock()
+	})
+
+	return nil
+}
+
+func (conn *reliableUDPConn) release() {
+	conn.releaseOnce.Do(func() {
+		close(conn.released)
+		conn.onRelease(conn)
+	})
+}
+
+func (conn *reliableUDPConn) LocalAddr() net.Addr {
+	return conn.localAddr
+}
+
+func (conn *reliableUDPConn) RemoteAddr() net.Addr {
+	return conn.remoteAddr
+}
+
+func (conn *reliableUDPConn) SetDeadline(t time.Time) error {
+	conn.readDeadline.set(t)
+	conn.writeDeadline.set(t)
+
+	return nil
+}
+
+func (conn *reliableUDPConn) SetReadDeadline(t time.Time) error {
+	conn.readDeadline.set(t)
+
+	return nil
+}
+
+func (conn *reliableUDPConn) SetWriteDeadline(t time.Time) error {
+	conn.writeDeadline.set(t)
+
+	return nil
+}
+
+func newReliableUDPConn(conv uint32, settings ReliableUDPSettings, localAddr net.Addr, remoteAddr net.Addr,
+	write func(datagram []byte), onRelease func(conn *reliableUDPConn)) *reliableUDPConn {
+	conn := &reliableUDPConn{
+		settings:      settings,
+		localAddr:     localAddr,
+		remoteAddr:    remoteAddr,
+		write:         write,
+		onRelease:     onRelease,
+		readable:      make(chan struct{}, 1),
+		writable:      make(chan struct{}, 1),
+		established:   make(chan struct{}),
+		closed:        make(chan struct{}),
+		released:      make(chan struct{}),
+		readDeadline:  newConnDeadline(),
+		writeDeadline: newConnDeadline(),
+	}
+
+	conn.arq = newARQ(conv, settings, conn.output)
+
+	return conn
+}
+
+// reliableUDPListener demultiplexes one UDP socket into reliable connections
+// keyed by remote address. The socket stays open after Close until every
+// accepted connection has finished closing.
+type reliableUDPListener struct {
+	mutex     sync.Mutex
+	conn      *net.UDPConn
+	settings  ReliableUDPSettings
+	conns     map[string]*reliableUDPConn
+	accepts   chan *reliableUDPConn
+	closed    chan struct{}
+	closeOnce sync.Once
+	isClosed  bool
+}
+
+func (listener *reliableUDPListener) doRead() {
+	buffer := make([]byte, maxDatagramSize)
+
+	for {
+		size, remoteAddr, err := listener.conn.ReadFromUDP(buffer)
+
+		if err != nil {
+			if isTemporary(err) {
+				continue
+			}
+
+			return
+		}
+
+		if size < arqHeaderSize {
+			continue
+		}
+
+		datagram := make([]byte, size)
+		copy(datagram, buffer[:size])
+		listener.dispatch(remoteAddr, datagram)
+	}
+}
+
+func (listener *reliableUDPListener) dispatch(remoteAddr *net.UDPAddr, datagram []byte) {
+	key := remoteAddr.String()
+	conv := binary.LittleEndian.Uint32(datagram)
+
+	listener.mutex.Lock()
+	conn, ok := listener.conns[key]
+
+	if ok {
+		listener.mutex.Unlock()
+
+		if conn.arq.conv == conv {
+			conn.input(datagram)
+		}
+
+		return
+	}
+
+	if listener.isClosed || !isOpeningSegment(datagram) {
+		listener.mutex.Unlock()
+		return
+	}
+
+	conn = newReliableUDPConn(conv, listener.settings, listener.conn.LocalAddr(), remoteAddr,
+		func(datagram []byte) {
+			listener.conn.WriteToUDP(datagram, remoteAddr)
+		}, listener.remove)
+	conn.isOpen = true
+	close(conn.established)
+
+	select {
+	case listener.accepts <- conn:
+		listener.conns[key] = conn
+	default:
+		listener.mutex.Unlock()
+		return
+	}
+
+	listener.mutex.Unlock()
+	go conn.run()
+	conn.input(datagram)
+}
+
+func (listener *reliableUDPListener) remove(conn *reliableUDPConn) {
+	listener.mutex.Lock()
+	defer listener.mutex.Unlock()
+
+	key := conn.remoteAddr.String()
+
+	if listener.conns[key] == conn {
+		delete(listener.conns, key)
+	}
+
+	if listener.isClosed && len(listener.conns) == 0 {
+		listener.conn.Close()
+	}
+}
+
+func (listener *reliableUDPListener) Accept() (net.Conn, error) {
+	select {
+	case <-listener.closed:
+		return nil, net.ErrClosed
+	default:
+	}
+
+	select {
+	case conn := <-listener.accepts:
+		return conn, nil
+	case <-listener.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (listener *reliableUDPListener) Close() error {
+	listener.closeOnce.Do(func() {
+		close(listener.closed)
+
+		listener.mutex.Lock()
+		listener.isClosed = true
+		pending := len(listener.accepts)
+		idle := len(listener.conns) == 0
+		listener.mutex.Unlock()
+
+		for i := 0; i < pending; i++ {
+			select {
+			case conn := <-listener.accepts:
+				conn.Close()
+			default:
+			}
+		}
+
+		if idle {
+			listener.conn.Close()
+		}
+	})
+
+	return nil
+}
+
+func (listener *reliableUDPListener) Addr() net.Addr {
+	return listener.conn.LocalAddr()
+}
+
+// ListenReliableUDP listens for reliable UDP connections on network "udp",
+// "udp4" or "udp6". The returned listener can be passed to Acceptor.Serve.
+func ListenReliableUDP(network string, address string, settings ReliableUDPSettings) (net.Listener, error) {
+	settings.setDefaults()
+	udpAddr, err := net.ResolveUDPAddr(network, address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP(network, udpAddr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	listener := &reliableUDPListener{
+		conn:     conn,
+		settings: settings,
+		conns:    map[string]*reliableUDPConn{},
+		accepts:  make(chan *reliableUDPConn, settings.AcceptBacklog),
+		closed:   make(chan struct{}),
+	}
+
+	go listener.doRead()
+
+	return listener, nil
+}
+
+// DialReliableUDP opens a reliable UDP connection on network "udp", "udp4"
+// or "udp6" and waits until the peer acknowledges it or DialTimeout passes.
+func DialReliableUDP(network string, address string, settings ReliableUDPSettings) (net.Conn, error) {
+	settings.setDefaults()
+	remoteAddr, err := net.ResolveUDPAddr(network, address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	udpConn, err := net.DialUDP(network, nil, remoteAddr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var convBytes [4]byte
+
+	_, err = rand.Read(convBytes[:])
+
+	if err != nil {
+		udpConn.Close()
+		return nil, err
+	}
+
+	conn := newReliableUDPConn(binary.LittleEndian.Uint32(convBytes[:]), settings, udpConn.LocalAddr(), remoteAddr,
+		func(datagram []byte) {
+			udpConn.Write(datagram)
+		}, func(conn *reliableUDPConn) {
+			udpConn.Close()
+		})
+
+	go conn.run()
+	go readReliableUDP(udpConn, conn)
+
+	conn.mutex.Lock()
+	conn.arq.sendControl(arqCmdPush)
+	conn.arq.flush()
+	conn.mutex.Unlock()
+
+	timer := time.NewTimer(settings.DialTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-conn.established:
+		return conn, nil
+	case <-timer.C:
+	}
+
+	conn.release()
+
+	return nil, &net.OpError{Op: "dial", Net: network, Addr: remoteAddr, Err: ErrDialTimeout}
+}
+
+// isOpeningSegment reports whether a datagram from an unknown address starts
+// with the first push of a new stream, so that stray retransmissions from
+// connections that were already released do not create new ones.
+func isOpeningSegment(datagram []byte) bool {
+	return datagram[4] == arqCmdPush && binary.LittleEndian.Uint32(datagram[11:]) == 0
+}
+
+func isConnectionRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+func readReliableUDP(udpConn *net.UDPConn, conn *reliableUDPConn) {
+	buffer := make([]byte, maxDatagramSize)
+
+	for {
+		size, err := udpConn.Read(buffer)
+
+		if err != nil {
+			select {
+			case <-conn.released:
+				return
+			default:
+			}
+
+			if isTemporary(err) || isConnectionRefused(err) {
+				continue
+			}
+
+			return
+		}
+
+		if size >= arqHeaderSize {
+			conn.input(buffer[:size])
+		}
+	}
+}
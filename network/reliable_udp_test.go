@@ -0,0 +1,141 @@
+package network
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lossyProxy relays datagrams between one client and a server, dropping a
+// share of them in both directions and delaying the rest.
+type lossyProxy struct {
+	conn    *net.UDPConn
+	server  *net.UDPAddr
+	loss    float64
+	latency time.Duration
+
+	mutex  sync.Mutex
+	random *rand.Rand
+	client *net.UDPAddr
+}
+
+func newLossyProxy(t *testing.T, server net.Addr, loss float64, latency time.Duration) *lossyProxy {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := &lossyProxy{
+		conn:    conn,
+		server:  server.(*net.UDPAddr),
+		loss:    loss,
+		latency: latency,
+		random:  rand.New(rand.NewSource(1)),
+	}
+
+	go proxy.run()
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	return proxy
+}
+
+func (proxy *lossyProxy) run() {
+	buffer := make([]byte, maxDatagramSize)
+
+	for {
+		size, from, err := proxy.conn.ReadFromUDP(buffer)
+
+		if err != nil {
+			return
+		}
+
+		proxy.mutex.Lock()
+		drop := proxy.random.Float64() < proxy.loss
+		to := proxy.server
+
+		if from.String() == proxy.server.String() {
+			to = proxy.client
+		} else {
+			proxy.client = from
+		}
+
+		proxy.mutex.Unlock()
+
+		if drop || to == nil {
+			continue
+		}
+
+		datagram := append([]byte(nil), buffer[:size]...)
+
+		time.AfterFunc(proxy.latency, func() {
+			proxy.conn.WriteToUDP(datagram, to)
+		})
+	}
+}
+
+func TestReliableUDPOverLossyLink(t *testing.T) {
+	const packets = 2000
+
+	if testing.Short() {
+		t.Skip("lossy link test takes several seconds")
+	}
+
+	received := make(chan uint32, packets)
+	acceptor := NewAcceptor(AcceptorSettings{
+		Transport: TransportReliableUDP,
+		SessionSettings: SessionSettings{
+			OnRead: func(session *Session, data []byte, size int) {
+				received <- binary.BigEndian.Uint32(data)
+			},
+		},
+	})
+
+	if !acceptor.Listen("udp", "127.0.0.1:0") {
+		t.Fatal("reliable UDP listen failed")
+	}
+
+	defer acceptor.Stop()
+
+	proxy := newLossyProxy(t, acceptor.listener.Addr(), 0.2, time.Millisecond*5)
+	connector := NewConnector(ConnectorSettings{Transport: TransportReliableUDP})
+
+	if !connector.DialNetwork("udp", proxy.conn.LocalAddr().String()) {
+		t.Fatal("reliable UDP dial through the lossy proxy failed")
+	}
+
+	connector.Start()
+	defer connector.Stop()
+
+	session := connector.GetSession()
+
+	for i := uint32(0); i < packets; i++ {
+		packet := make([]byte, 64)
+		binary.BigEndian.PutUint32(packet, i)
+		err := session.SendPacket(packet)
+
+		if err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+
+	timeout := time.After(time.Second * 30)
+
+	for i := uint32(0); i < packets; i++ {
+		select {
+		case seq := <-received:
+			if seq != i {
+				t.Fatalf("received packet %d, want %d", seq, i)
+			}
+		case <-timeout:
+			t.Fatalf("received %d of %d packets", i, packets)
+		}
+	}
+}
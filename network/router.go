@@ -0,0 +1,215 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const defaultMessageIDSize = 4
+
+var (
+	ErrInvalidMessageIDSize = errors.New("message id size must be 1, 2, 4 or 8")
+	ErrMissingMessageID     = &ProtocolError{Reason: "packet is shorter than the message id"}
+	ErrUnknownMessageID     = errors.New("no handler registered for message id")
+)
+
+type routerHandlerFunc func(session *Session, msg interface{})
+type routerUnknownFunc func(session *Session, id uint64, payload []byte)
+
+type RouterSettings struct {
+	MessageIDSize int
+	ByteOrder     binary.ByteOrder
+
+	OnUnknown routerUnknownFunc
+}
+
+type routerEntry struct {
+	handler    routerHandlerFunc
+	newMessage NewMessageFunc
+}
+
+type Router struct {
+	mutex    sync.RWMutex
+	handlers map[uint64]routerEntry
+
+	messageIDSize int
+	byteOrder     binary.ByteOrder
+
+	onUnknown routerUnknownFunc
+}
+
+func (router *Router) Register(id uint64, handler routerHandlerFunc, newMessage NewMessageFunc) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+
+	router.handlers[id] = routerEntry{
+		handler:    handler,
+		newMessage: newMessage,
+	}
+}
+
+func (router *Router) Unregister(id uint64) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+
+	delete(router.handlers, id)
+}
+
+func (router *Router) OnRead(session *Session, data []byte, size int) {
+	router.Dispatch(session, data)
+}
+
+func (router *Router) Dispatch(session *Session, data []byte) {
+	if len(data) < router.messageIDSize {
+		session.reportError(ErrMissingMessageID)
+		return
+	}
+
+	id := router.readMessageID(data)
+	payload := data[router.messageIDSize:]
+
+	router.mutex.RLock()
+	entry, ok := router.handlers[id]
+	router.mutex.RUnlock()
+
+	if !ok {
+		router.handleUnknown(session, id, payload)
+		return
+	}
+
+	msg, err := router.decode(session, entry, payload)
+
+	if err != nil {
+		session.reportError(err)
+		return
+	}
+
+	router.callHandler(session, id, func() {
+		entry.handler(session, msg)
+	})
+}
+
+func (router *Router) handleUnknown(session *Session, id uint64, payload []byte) {
+	if router.onUnknown == nil {
+		session.reportError(fmt.Errorf("%w: %d", ErrUnknownMessageID, id))
+		return
+	}
+
+	router.callHandler(session, id, func() {
+		router.onUnknown(session, id, payload)
+	})
+}
+
+func (router *Router) callHandler(session *Session, id uint64, handler func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			session.reportError(fmt.Errorf("handler for message id %d panicked: %v", id, r))
+		}
+	}()
+
+	handler()
+}
+
+func (router *Router) decode(session *Session, entry routerEntry, payload []byte) (interface{}, error) {
+	codec := session.GetCodec()
+
+	if codec == nil {
+		return payload, nil
+	}
+
+	if entry.newMessage == nil {
+		return codec.Decode(payload)
+	}
+
+	msg := entry.newMessage()
+	err := codec.DecodeInto(payload, msg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (router *Router) Send(session *Session, id uint64, msg interface{}) error {
+	codec := session.GetCodec()
+
+	if codec == nil {
+		payload, ok := msg.([]byte)
+
+		if !ok {
+			return ErrNoCodec
+		}
+
+		return session.SendPacket(router.Pack(id, payload))
+	}
+
+	payload, err := codec.Encode(msg)
+
+	if err != nil {
+		return err
+	}
+
+	return session.SendPacket(router.Pack(id, payload))
+}
+
+func (router *Router) Pack(id uint64, payload []byte) []byte {
+	packet := make([]byte, router.messageIDSize+len(payload))
+	router.writeMessageID(packet, id)
+	copy(packet[router.messageIDSize:], payload)
+
+	return packet
+}
+
+func (router *Router) readMessageID(data []byte) uint64 {
+	switch router.messageIDSize {
+	case 1:
+		return uint64(data[0])
+	case 2:
+		return uint64(router.byteOrder.Uint16(data))
+	case 4:
+		return uint64(router.byteOrder.Uint32(data))
+	default:
+		return router.byteOrder.Uint64(data)
+	}
+}
+
+func (router *Router) writeMessageID(data []byte, id uint64) {
+	switch router.messageIDSize {
+	case 1:
+		data[0] = byte(id)
+	case 2:
+		router.byteOrder.PutUint16(data, uint16(id))
+	case 4:
+		router.byteOrder.PutUint32(data, uint32(id))
+	default:
+		router.byteOrder.PutUint64(data, id)
+	}
+}
+
+func NewRouter(settings RouterSettings) (*Router, error) {
+	router := &Router{
+		handlers:      map[uint64]routerEntry{},
+		messageIDSize: settings.MessageIDSize,
+		byteOrder:     settings.ByteOrder,
+		onUnknown:     settings.OnUnknown,
+	}
+
+	if router.messageIDSize == 0 {
+		router.messageIDSize = defaultMessageIDSize
+	}
+
+	switch router.messageIDSize {
+	case 1, 2, 4, 8:
+	default:
+		return nil, ErrInvalidMessageIDSize
+	}
+
+	if router.byteOrder == nil {
+		router.byteOrder = binary.BigEndian
+	}
+
+	return router, nil
+}
@@ -0,0 +1,139 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestRouter(t *testing.T, settings RouterSettings) *Router {
+	t.Helper()
+
+	router, err := NewRouter(settings)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return router
+}
+
+func newErrorSession(t *testing.T) (*Session, chan error) {
+	t.Helper()
+
+	errs := make(chan error, 4)
+	session, _ := newPipeSession(t, SessionSettings{
+		OnError: func(session *Session, err error) {
+			errs <- err
+		},
+	})
+
+	return session, errs
+}
+
+func TestRouterDispatch(t *testing.T) {
+	router := newTestRouter(t, RouterSettings{MessageIDSize: 2, ByteOrder: binary.LittleEndian})
+	session, _ := newErrorSession(t)
+	var got []byte
+
+	router.Register(7, func(session *Session, msg interface{}) {
+		got = msg.([]byte)
+	}, nil)
+
+	packet := router.Pack(7, []byte("payload"))
+
+	if packet[0] != 7 || packet[1] != 0 {
+		t.Fatalf("Pack wrote id bytes %v, want little endian 7", packet[:2])
+	}
+
+	router.Dispatch(session, packet)
+
+	if string(got) != "payload" {
+		t.Fatalf("handler got %q, want payload", got)
+	}
+}
+
+func TestRouterDecodesWithSessionCodec(t *testing.T) {
+	router := newTestRouter(t, RouterSettings{})
+	session, _ := newErrorSession(t)
+	session.SetCodec(NewJSONCodec(nil))
+	var got *codecTestMessage
+
+	router.Register(1, func(session *Session, msg interface{}) {
+		got = msg.(*codecTestMessage)
+	}, func() interface{} {
+		return &codecTestMessage{}
+	})
+
+	router.Dispatch(session, router.Pack(1, []byte(`{"Name":"routed","Count":2}`)))
+
+	if got == nil || got.Name != "routed" || got.Count != 2 {
+		t.Fatalf("handler got %#v", got)
+	}
+}
+
+func TestRouterUnknownID(t *testing.T) {
+	session, errs := newErrorSession(t)
+	router := newTestRouter(t, RouterSettings{})
+
+	router.Dispatch(session, router.Pack(9, nil))
+
+	err := <-errs
+
+	if !errors.Is(err, ErrUnknownMessageID) {
+		t.Fatalf("unknown id reported %v, want %v", err, ErrUnknownMessageID)
+	}
+
+	var unknownID uint64
+	var unknownPayload []byte
+	router = newTestRouter(t, RouterSettings{
+		OnUnknown: func(session *Session, id uint64, payload []byte) {
+			unknownID = id
+			unknownPayload = payload
+		},
+	})
+
+	router.Dispatch(session, router.Pack(9, []byte("rest")))
+
+	if unknownID != 9 || string(unknownPayload) != "rest" {
+		t.Fatalf("OnUnknown got %d, %q, want 9, rest", unknownID, unknownPayload)
+	}
+}
+
+func TestRouterRecoversHandlerPanic(t *testing.T) {
+	session, errs := newErrorSession(t)
+	router := newTestRouter(t, RouterSettings{})
+
+	router.Register(3, func(session *Session, msg interface{}) {
+		panic("boom")
+	}, nil)
+
+	router.Dispatch(session, router.Pack(3, nil))
+	err := <-errs
+
+	if !strings.Contains(err.Error(), "panicked: boom") {
+		t.Fatalf("panic reported as %v", err)
+	}
+}
+
+func TestRouterShortPacket(t *testing.T) {
+	session, errs := newErrorSession(t)
+	router := newTestRouter(t, RouterSettings{})
+
+	router.Dispatch(session, []byte{1, 2})
+
+	err := <-errs
+
+	if err != ErrMissingMessageID {
+		t.Fatalf("short packet reported %v, want %v", err, ErrMissingMessageID)
+	}
+}
+
+func TestNewRouterRejectsInvalidIDSize(t *testing.T) {
+	_, err := NewRouter(RouterSettings{MessageIDSize: 3})
+
+	if err != ErrInvalidMessageIDSize {
+		t.Fatalf("NewRouter with id size 3 = %v, want %v", err, ErrInvalidMessageIDSize)
+	}
+}
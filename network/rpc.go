@@ -0,0 +1,363 @@
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	rpcRequest       = 1
+	rpcResponse      = 2
+	rpcErrorResponse = 3
+
+	rpcHeaderSize                   = 7
+	rpcMaxNameSize                  = 1<<16 - 1
+	defaultRPCTimeout               = time.Second * 30
+	defaultRPCMaxConcurrentRequests = 256
+)
+
+var (
+	ErrMalformedRPC      error = &ProtocolError{Reason: "malformed rpc packet"}
+	ErrMethodNotFound          = errors.New("rpc method not found")
+	ErrRPCBusy                 = errors.New("rpc server busy")
+	ErrSessionStarted          = errors.New("session already started")
+	ErrMethodNameTooLong       = errors.New("rpc method name exceeds 65535 bytes")
+
+	rpcRemoteErrors = []error{ErrMethodNotFound, ErrRPCBusy}
+)
+
+type RPCError struct {
+	Method  string
+	Message string
+}
+
+func (err *RPCError) Error() string {
+	return fmt.Sprintf("rpc %s: %s", err.Method, err.Message)
+}
+
+// Is matches the errors the RPC layer itself answers with, such as
+// ErrMethodNotFound and ErrRPCBusy, since only their text crosses the wire.
+func (err *RPCError) Is(target error) bool {
+	for _, remoteErr := range rpcRemoteErrors {
+		if target == remoteErr {
+			return err.Message == remoteErr.Error()
+		}
+	}
+
+	return false
+}
+
+type rpcHandlerFunc func(session *Session, req interface{}) (interface{}, error)
+
+// RPCSettings configures an RPC endpoint. MaxConcurrentRequests caps the
+// handlers running at once; requests beyond it are answered with ErrRPCBusy
+// instead of stalling the session's read loop.
+type RPCSettings struct {
+	Timeout               time.Duration
+	MaxConcurrentRequests int
+}
+
+type rpcMethod struct {
+	handler    rpcHandlerFunc
+	newRequest NewMessageFunc
+}
+
+type rpcCall struct {
+	method string
+	result chan rpcResult
+}
+
+type rpcResult struct {
+	payload []byte
+	err     error
+}
+
+type RPC struct {
+	session *Session
+	timeout time.Duration
+	nextSeq uint32
+	slots   chan struct{}
+
+	mutex   sync.Mutex
+	pending map[uint32]*rpcCall
+	methods map[string]rpcMethod
+}
+
+func (rpc *RPC) Register(method string, handler rpcHandlerFunc, newRequest NewMessageFunc) {
+	rpc.mutex.Lock()
+	defer rpc.mutex.Unlock()
+
+	rpc.methods[method] = rpcMethod{
+		handler:    handler,
+		newRequest: newRequest,
+	}
+}
+
+func (rpc *RPC) Call(ctx context.Context, method string, req interface{}) (interface{}, error) {
+	if len(method) > rpcMaxNameSize {
+		return nil, ErrMethodNameTooLong
+	}
+
+	payload, err := rpc.encode(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := ctx.Deadline(); !ok && rpc.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rpc.timeout)
+		defer cancel()
+	}
+
+	seq := atomic.AddUint32(&rpc.nextSeq, 1)
+	call := &rpcCall{
+		method: method,
+		result: make(chan rpcResult, 1),
+	}
+
+	rpc.mutex.Lock()
+	rpc.pending[seq] = call
+	rpc.mutex.Unlock()
+
+	defer func() {
+		rpc.mutex.Lock()
+		delete(rpc.pending, seq)
+		rpc.mutex.Unlock()
+	}()
+
+	err = rpc.session.SendPacket(buildRPCPacket(rpcRequest, seq, method, payload))
+
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case result := <-call.result:
+		if result.err != nil {
+			return nil, result.err
+		}
+
+		return rpc.decode(result.payload)
+	case <-rpc.session.Done():
+		return nil, ErrSessionClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (rpc *RPC) OnRead(session *Session, data []byte, size int) {
+	kind, seq, name, payload, err := parseRPCPacket(data)
+
+	if err != nil {
+		session.reportError(err)
+		return
+	}
+
+	payload = append([]byte(nil), payload...)
+
+	switch kind {
+	case rpcRequest:
+		select {
+		case rpc.slots <- struct{}{}:
+			go func() {
+				defer func() { <-rpc.slots }()
+				rpc.handleRequest(seq, name, payload)
+			}()
+		default:
+			rpc.sendError(seq, ErrRPCBusy)
+		}
+	case rpcResponse:
+		rpc.handleResponse(seq, false, "", payload)
+	case rpcErrorResponse:
+		rpc.handleResponse(seq, true, name, nil)
+	}
+}
+
+func (rpc *RPC) handleRequest(seq uint32, method string, payload []byte) {
+	resp, err := rpc.invoke(method, payload)
+
+	if err == nil {
+		payload, err = rpc.encode(resp)
+	}
+
+	if err != nil {
+		rpc.sendError(seq, err)
+		return
+	}
+
+	rpc.session.SendPacket(buildRPCPacket(rpcResponse, seq, "", payload))
+}
+
+func (rpc *RPC) sendError(seq uint32, err error) {
+	message := err.Error()
+
+	if len(message) > rpcMaxNameSize {
+		message = message[:rpcMaxNameSize]
+	}
+
+	rpc.session.SendPacket(buildRPCPacket(rpcErrorResponse, seq, message, nil))
+}
+
+func (rpc *RPC) invoke(method string, payload []byte) (resp interface{}, err error) {
+	rpc.mutex.Lock()
+	entry, ok := rpc.methods[method]
+	rpc.mutex.Unlock()
+
+	if !ok {
+		return nil, ErrMethodNotFound
+	}
+
+	req, err := rpc.decodeRequest(entry, payload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+
+	return entry.handler(rpc.session, req)
+}
+
+// handleResponse delivers a reply to its pending call. Error replies carry
+// their own kind so that an empty error message is still an error.
+func (rpc *RPC) handleResponse(seq uint32, failed bool, message string, payload []byte) {
+	rpc.mutex.Lock()
+	call, ok := rpc.pending[seq]
+	delete(rpc.pending, seq)
+	rpc.mutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if failed {
+		call.result <- rpcResult{err: &RPCError{Method: call.method, Message: message}}
+		return
+	}
+
+	call.result <- rpcResult{payload: payload}
+}
+
+func (rpc *RPC) encode(msg interface{}) ([]byte, error) {
+	codec := rpc.session.GetCodec()
+
+	if codec != nil {
+		return codec.Encode(msg)
+	}
+
+	if msg == nil {
+		return nil, nil
+	}
+
+	data, ok := msg.([]byte)
+
+	if !ok {
+		return nil, ErrNoCodec
+	}
+
+	return data, nil
+}
+
+func (rpc *RPC) decode(payload []byte) (interface{}, error) {
+	codec := rpc.session.GetCodec()
+
+	if codec == nil {
+		return payload, nil
+	}
+
+	return codec.Decode(payload)
+}
+
+func (rpc *RPC) decodeRequest(entry rpcMethod, payload []byte) (interface{}, error) {
+	codec := rpc.session.GetCodec()
+
+	if codec == nil || entry.newRequest == nil {
+		return rpc.decode(payload)
+	}
+
+	req := entry.newRequest()
+	err := codec.DecodeInto(payload, req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func buildRPCPacket(kind byte, seq uint32, name string, payload []byte) []byte {
+	packet := make([]byte, rpcHeaderSize+len(name)+len(payload))
+	packet[0] = kind
+	binary.BigEndian.PutUint32(packet[1:], seq)
+	binary.BigEndian.PutUint16(packet[5:], uint16(len(name)))
+	copy(packet[rpcHeaderSize:], name)
+	copy(packet[rpcHeaderSize+len(name):], payload)
+
+	return packet
+}
+
+func parseRPCPacket(data []byte) (byte, uint32, string, []byte, error) {
+	if len(data) < rpcHeaderSize {
+		return 0, 0, "", nil, ErrMalformedRPC
+	}
+
+	kind := data[0]
+	seq := binary.BigEndian.Uint32(data[1:])
+	nameSize := int(binary.BigEndian.Uint16(data[5:]))
+
+	if kind < rpcRequest || kind > rpcErrorResponse {
+		return 0, 0, "", nil, ErrMalformedRPC
+	}
+
+	if len(data) < rpcHeaderSize+nameSize {
+		return 0, 0, "", nil, ErrMalformedRPC
+	}
+
+	name := string(data[rpcHeaderSize : rpcHeaderSize+nameSize])
+	payload := data[rpcHeaderSize+nameSize:]
+
+	return kind, seq, name, payload, nil
+}
+
+// NewRPC attaches an RPC endpoint to session by replacing its OnRead callback;
+// every packet on the session is then parsed as RPC and the previous OnRead is
+// no longer called, so carry other traffic on a separate session. It must run
+// before the session is started, for example from OnNewSession or before
+// Connector.Start, and fails with ErrSessionStarted otherwise.
+func NewRPC(session *Session, settings RPCSettings) (*RPC, error) {
+	if session.isStarted() {
+		return nil, ErrSessionStarted
+	}
+
+	maxConcurrentRequests := settings.MaxConcurrentRequests
+
+	if maxConcurrentRequests <= 0 {
+		maxConcurrentRequests = defaultRPCMaxConcurrentRequests
+	}
+
+	rpc := &RPC{
+		session: session,
+		timeout: settings.Timeout,
+		slots:   make(chan struct{}, maxConcurrentRequests),
+		pending: map[uint32]*rpcCall{},
+		methods: map[string]rpcMethod{},
+	}
+
+	if rpc.timeout == 0 {
+		rpc.timeout = defaultRPCTimeout
+	}
+
+	session.OnRead = rpc.OnRead
+
+	return rpc, nil
+}
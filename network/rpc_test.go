@@ -0,0 +1,158 @@
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRPCSession(t *testing.T, conn net.Conn, settings RPCSettings) *RPC {
+	t.Helper()
+
+	session := NewSessionFromConn(SessionSettings{}, conn)
+	rpc, err := NewRPC(session, settings)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session.Start()
+	t.Cleanup(session.Stop)
+
+	return rpc
+}
+
+func readTestPacket(conn net.Conn) ([]byte, error) {
+	var header [4]byte
+
+	_, err := io.ReadFull(conn, header[:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	packet := make([]byte, binary.BigEndian.Uint32(header[:]))
+	_, err = io.ReadFull(conn, packet)
+
+	return packet, err
+}
+
+func TestRPCIgnoresDuplicateResponses(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	client := newRPCSession(t, local, RPCSettings{})
+
+	go func() {
+		for {
+			packet, err := readTestPacket(remote)
+
+			if err != nil {
+				return
+			}
+
+			_, seq, _, payload, _ := parseRPCPacket(packet)
+			response := buildPacket(buildRPCPacket(rpcResponse, seq, "", payload))
+
+			for i := 0; i < 3; i++ {
+				_, err = remote.Write(response)
+
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		resp, err := client.Call(ctx, "echo", []byte("ping"))
+		cancel()
+
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+
+		if string(resp.([]byte)) != "ping" {
+			t.Fatalf("call %d: response %q, want ping", i, resp)
+		}
+	}
+}
+
+func TestRPCRejectsRequestsBeyondConcurrencyLimit(t *testing.T) {
+	local, remote := net.Pipe()
+	server := newRPCSession(t, local, RPCSettings{MaxConcurrentRequests: 1})
+	client := newRPCSession(t, remote, RPCSettings{})
+	release := make(chan struct{})
+	defer close(release)
+
+	server.Register("wait", func(session *Session, req interface{}) (interface{}, error) {
+		<-release
+		return req, nil
+	}, nil)
+
+	go client.Call(context.Background(), "wait", []byte("first"))
+	time.Sleep(time.Millisecond * 50)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := client.Call(ctx, "wait", []byte("second"))
+
+	if !errors.Is(err, ErrRPCBusy) {
+		t.Fatalf("second call error = %v, want %v", err, ErrRPCBusy)
+	}
+}
+
+func newRPCPair(t *testing.T) (*RPC, *RPC) {
+	t.Helper()
+
+	local, remote := net.Pipe()
+
+	return newRPCSession(t, local, RPCSettings{}), newRPCSession(t, remote, RPCSettings{})
+}
+
+func TestRPCErrors(t *testing.T) {
+	server, client := newRPCPair(t)
+
+	server.Register("fail", func(session *Session, req interface{}) (interface{}, error) {
+		return nil, errors.New("")
+	}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := client.Call(ctx, "missing", []byte("x"))
+
+	if !errors.Is(err, ErrMethodNotFound) {
+		t.Fatalf("unknown method error = %v, want %v", err, ErrMethodNotFound)
+	}
+
+	_, err = client.Call(ctx, "fail", []byte("x"))
+	var rpcErr *RPCError
+
+	if !errors.As(err, &rpcErr) || rpcErr.Message != "" || errors.Is(err, ErrMethodNotFound) {
+		t.Fatalf("empty handler error = %v, want an RPCError with an empty message", err)
+	}
+
+	_, err = client.Call(ctx, strings.Repeat("m", rpcMaxNameSize+1), []byte("x"))
+
+	if err != ErrMethodNameTooLong {
+		t.Fatalf("long method name error = %v, want %v", err, ErrMethodNameTooLong)
+	}
+}
+
+func TestNewRPCAfterStart(t *testing.T) {
+	session, _ := newPipeSession(t, SessionSettings{})
+
+	_, err := NewRPC(session, RPCSettings{})
+
+	if err != ErrSessionStarted {
+		t.Fatalf("NewRPC after Start = %v, want %v", err, ErrSessionStarted)
+	}
+}
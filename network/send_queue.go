@@ -0,0 +1,154 @@
+package network
+
+import (
+	"sync"
+)
+
+const defaultMaxBatchSize = 64
+
+type SendQueueFullPolicy int
+
+const (
+	SendQueueFullBlock SendQueueFullPolicy = iota
+	SendQueueFullDrop
+	SendQueueFullDisconnect
+)
+
+type outboundPacket struct {
+	header  []byte
+	payload []byte
+	pooled  bool
+}
+
+func (packet outboundPacket) size() int {
+	return len(packet.header) + len(packet.payload)
+}
+
+func (packet outboundPacket) release() {
+	if packet.pooled {
+		putBuffer(packet.header)
+	}
+}
+
+type sendQueue struct {
+	mutex sync.Mutex
+	cond  *sync.Cond
+
+	packets       []outboundPacket
+	size          int
+	maxSize       int
+	maxPacketSize int
+	closed        bool
+}
+
+func (queue *sendQueue) push(packet outboundPacket, block bool) error {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	if queue.closed {
+		return ErrSessionClosed
+	}
+
+	if packet.size() > queue.maxSize {
+		return &PacketSizeError{Size: packet.size(), Limit: queue.maxSize}
+	}
+
+	if queue.maxPacketSize > 0 && packet.size() > queue.maxPacketSize {
+		return &PacketSizeError{Size: packet.size(), Limit: queue.maxPacketSize}
+	}
+
+	for queue.size+packet.size() > queue.maxSize {
+		if !block {
+			return ErrSendQueueFull
+		}
+
+		queue.cond.Wait()
+
+		if queue.closed {
+			return ErrSessionClosed
+		}
+	}
+
+	queue.packets = append(queue.packets, packet)
+	queue.size += packet.size()
+	queue.cond.Broadcast()
+
+	return nil
+}
+
+func (queue *sendQueue) popBatch(packets []outboundPacket, maxCount int) ([]outboundPacket, bool) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	for len(queue.packets) == 0 {
+		if queue.closed {
+			return packets, false
+		}
+
+		queue.cond.Wait()
+	}
+
+	return queue.take(packets, maxCount), true
+}
+
+func (queue *sendQueue) tryPopBatch(packets []outboundPacket, maxCount int) []outboundPacket {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	return queue.take(packets, maxCount)
+}
+
+func (queue *sendQueue) take(packets []outboundPacket, maxCount int) []outboundPacket {
+	count := len(queue.packets)
+
+	if count > maxCount {
+		count = maxCount
+	}
+
+	for i := 0; i < count; i++ {
+		packets = append(packets, queue.packets[i])
+		queue.size -= queue.packets[i].size()
+		queue.packets[i] = outboundPacket{}
+	}
+
+	queue.packets = queue.packets[count:]
+
+	if count > 0 {
+		queue.cond.Broadcast()
+	}
+
+	return packets
+}
+
+func (queue *sendQueue) close() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.closed = true
+
+	for _, packet := range queue.packets {
+		packet.release()
+	}
+
+	queue.packets = nil
+	queue.size = 0
+	queue.cond.Broadcast()
+}
+
+func (queue *sendQueue) closeWrite() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.closed = true
+	queue.cond.Broadcast()
+}
+
+func newSendQueue(maxSize int) *sendQueue {
+	queue := &sendQueue{
+		maxSize: maxSize,
+	}
+
+	queue.cond = sync.NewCond(&queue.mutex)
+
+	return queue
+}
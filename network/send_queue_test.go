@@ -0,0 +1,90 @@
+package network
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeCountingConn records the size of every Write on the wrapped connection.
+type writeCountingConn struct {
+	net.Conn
+
+	mutex  sync.Mutex
+	writes []int
+}
+
+func (conn *writeCountingConn) Write(data []byte) (int, error) {
+	conn.mutex.Lock()
+	conn.writes = append(conn.writes, len(data))
+	conn.mutex.Unlock()
+
+	return conn.Conn.Write(data)
+}
+
+func (conn *writeCountingConn) writeSizes() []int {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	return append([]int(nil), conn.writes...)
+}
+
+// sendCoalesced sends count packets of size bytes through a pipe session with
+// the given batching settings and returns the size of every write it made.
+func sendCoalesced(t *testing.T, settings SessionSettings, count int, size int) []int {
+	t.Helper()
+
+	local, remote := net.Pipe()
+	conn := &writeCountingConn{Conn: local}
+	written := make(chan struct{}, count)
+	settings.OnWrite = func(session *Session, size int) {
+		written <- struct{}{}
+	}
+
+	session := NewSessionFromConn(settings, conn)
+	session.Start()
+	defer session.Stop()
+	defer remote.Close()
+
+	go io.Copy(io.Discard, remote)
+
+	for i := 0; i < count; i++ {
+		err := session.SendPacket(make([]byte, size))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		select {
+		case <-written:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d of %d packets were written", i, count)
+		}
+	}
+
+	return conn.writeSizes()
+}
+
+func TestFlushIntervalCoalescesWrites(t *testing.T) {
+	writes := sendCoalesced(t, SessionSettings{FlushInterval: 50 * time.Millisecond}, 3, 10)
+
+	if len(writes) != 1 || writes[0] != 3*(4+10) {
+		t.Fatalf("writes = %v, want one write of %d bytes", writes, 3*(4+10))
+	}
+}
+
+func TestMaxBatchSizeBoundsCoalescedWrites(t *testing.T) {
+	settings := SessionSettings{
+		FlushInterval: 50 * time.Millisecond,
+		MaxBatchSize:  2,
+	}
+	writes := sendCoalesced(t, settings, 4, 10)
+
+	if len(writes) != 2 || writes[0] != 2*(4+10) || writes[1] != 2*(4+10) {
+		t.Fatalf("writes = %v, want two writes of %d bytes", writes, 2*(4+10))
+	}
+}
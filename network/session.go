@@ -1,7 +1,12 @@
 package network
 
 import (
+	"errors"
 	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -11,36 +16,103 @@ const (
 	maxPacketSize  = megaByteOfSize * 10
 )
 
+const defaultCloseGrace = time.Second * 5
+
+var nextSessionID uint64
+
 type sessionReadFunc func(session *Session, data []byte, size int)
 type sessionWriteFunc func(session *Session, bytesTransferred int)
 type sessionErrorFunc func(session *Session, err error)
-type sessionDisconnected func(session *Session)
+type sessionDisconnected func(session *Session, reason DisconnectReason)
+type sessionMessageFunc func(session *Session, msg interface{})
+type sessionRateLimitedFunc func(session *Session, size int, policy RateLimitPolicy)
 type parsePacketHeaderFunc func(conn net.Conn, maxRecvBuffSize int) (int, error)
 type buildPacketFunc func(data []byte) []byte
 
 type SessionSettings struct {
 	MaxRecvBuffSize int
 	MaxSendBuffSize int
+	SendQueueFullPolicy SendQueueFullPolicy
+	ReadIdleTimeout time.Duration
+	// WriteIdleTimeout disconnects the session with ErrWriteIdleTimeout once
+	// nothing has been written for this long. Heartbeat pings count as
+	// writes, so enable Heartbeat to keep otherwise quiet sessions alive.
+	WriteIdleTimeout time.Duration
+	// WriteTimeout bounds how long a single batch write may stall before the
+	// session is disconnected with ErrWriteTimeout. It does not fire when the
+	// session simply has nothing to send.
+	WriteTimeout time.Duration
+	Heartbeat HeartbeatSettings
+	ProtocolErrorFrame []byte
+	Framer Framer
+	Codec Codec
+	ReadBufferSize int
+	FlushInterval time.Duration
+	MaxBatchSize int
+	RecvRateLimit RecvRateLimitSettings
+
+	// ReuseReadBuffers recycles inbound packet buffers through a pool. The
+	// data passed to OnRead and the built-in framers is then only valid until
+	// OnRead returns and must be copied if it is retained.
+	ReuseReadBuffers bool
 
 	OnRead              sessionReadFunc
 	OnWrite             sessionWriteFunc
 	OnError             sessionErrorFunc
 	OnDisconnected      sessionDisconnected
+	OnMessage           sessionMessageFunc
+	OnRateLimited       sessionRateLimitedFunc
 	OnParsePacketHeader parsePacketHeaderFunc
 	OnBuildPacket buildPacketFunc
 }
 
 type Session struct {
+	stats sessionCounters
+	id uint64
 	socket *Socket
 	stop chan struct{}
+	stopOnce sync.Once
+	started int32
+	closing chan struct{}
+	closeOnce sync.Once
+	codecMutex sync.RWMutex
+	frameMutex sync.Mutex
+	inFrame bool
+	closeDeadline time.Time
+	sendDone chan struct{}
+	done chan struct{}
+	sendQueue *sendQueue
+
+	reasonMutex sync.Mutex
+	reason error
 
 	maxRecvBuffSize int
 	maxSendBuffSize int
+	sendQueueFullPolicy SendQueueFullPolicy
+	readIdleTimeout time.Duration
+	writeIdleTimeout time.Duration
+	writeTimeout time.Duration
+	heartbeat HeartbeatSettings
+	protocolErrorFrame []byte
+	framer Framer
+	metrics *Metrics
+	reader *bufferedConn
+	readBufferSize int
+	flushInterval time.Duration
+	maxBatchSize int
+	reuseReadBuffers bool
+	recvLimiter *recvLimiter
+	defaultBuildPacket bool
+	controlFrames bool
+	disconnectHooks []func(session *Session)
+	codec Codec
 
 	OnRead              sessionReadFunc
 	OnWrite             sessionWriteFunc
 	OnError             sessionErrorFunc
 	OnDisconnected      sessionDisconnected
+	OnMessage           sessionMessageFunc
+	OnRateLimited       sessionRateLimitedFunc
 	OnParsePacketHeader parsePacketHeaderFunc
 	OnBuildPacket buildPacketFunc
 }
@@ -50,10 +122,27 @@ func (session *Session) SetSessionSetting(settings SessionSettings) {
 	session.OnWrite = settings.OnWrite
 	session.OnError = settings.OnError
 	session.OnDisconnected = settings.OnDisconnected
+	session.OnMessage = settings.OnMessage
+	session.OnRateLimited = settings.OnRateLimited
 	session.OnParsePacketHeader = settings.OnParsePacketHeader
 	session.OnBuildPacket = settings.OnBuildPacket
 	session.maxRecvBuffSize = settings.MaxRecvBuffSize
 	session.maxSendBuffSize = settings.MaxSendBuffSize
+	session.sendQueueFullPolicy = settings.SendQueueFullPolicy
+	session.codec = settings.Codec
+	session.readIdleTimeout = settings.ReadIdleTimeout
+	session.writeIdleTimeout = settings.WriteIdleTimeout
+	session.writeTimeout = settings.WriteTimeout
+	session.heartbeat = settings.Heartbeat
+	session.protocolErrorFrame = settings.ProtocolErrorFrame
+	session.framer = settings.Framer
+	session.readBufferSize = settings.ReadBufferSize
+	session.flushInterval = settings.FlushInterval
+	session.maxBatchSize = settings.MaxBatchSize
+	session.reuseReadBuffers = settings.ReuseReadBuffers
+	session.recvLimiter = newRecvLimiter(settings.RecvRateLimit)
+	session.defaultBuildPacket = settings.OnBuildPacket == nil && settings.Framer == nil
+	session.controlFrames = session.defaultBuildPacket && settings.OnParsePacketHeader == nil
 
 	if session.OnRead == nil {
 		session.OnRead = func(session *Session, data []byte, size int) {
@@ -71,7 +160,12 @@ func (session *Session) SetSessionSetting(settings SessionSettings) {
 	}
 
 	if session.OnDisconnected == nil {
-		session.OnDisconnected = func(session *Session) {
+		session.OnDisconnected = func(session *Session, reason DisconnectReason) {
+		}
+	}
+
+	if session.OnRateLimited == nil {
+		session.OnRateLimited = func(session *Session, size int, policy RateLimitPolicy) {
 		}
 	}
 
@@ -83,6 +177,18 @@ func (session *Session) SetSessionSetting(settings SessionSettings) {
 		session.OnBuildPacket = buildPacket
 	}
 
+	if session.readBufferSize <= 0 {
+		session.readBufferSize = defaultReadBufferSize
+	}
+
+	if session.maxBatchSize <= 0 {
+		session.maxBatchSize = defaultMaxBatchSize
+	}
+
+	if session.framer == nil {
+		session.framer = &packetCallbackFramer{session: session}
+	}
+
 	if session.maxRecvBuffSize == 0 {
 		session.maxRecvBuffSize = maxPacketSize
 	}
@@ -90,46 +196,370 @@ func (session *Session) SetSessionSetting(settings SessionSettings) {
 	if session.maxSendBuffSize == 0 {
 		session.maxSendBuffSize = maxPacketSize
 	}
+
+	session.heartbeat.setDefaults()
 }
 
 func (session *Session) Start() {
+	atomic.StoreInt32(&session.started, 1)
+	go session.doSendPacket()
 	go session.doRecvPacket()
+
+	if session.writeIdleTimeout > 0 {
+		go session.doWriteIdleCheck()
+	}
+
+	if session.heartbeat.Enable {
+		go session.doHeartbeat()
+	}
 }
 
 func (session *Session) Stop() {
-	close(session.stop)
-	session.socket.Close()
+	session.stopWithReason(ErrLocalClose)
+}
+
+func (session *Session) isStarted() bool {
+	return atomic.LoadInt32(&session.started) == 1
+}
+
+func (session *Session) stopWithReason(reason error) {
+	session.setDisconnectReason(reason)
+	session.stopOnce.Do(func() {
+		close(session.stop)
+		session.sendQueue.close()
+		session.socket.Close()
+	})
+}
+
+// Close stops reading after the frame currently being received, flushes the
+// send queue and then disconnects. A partially received frame gets
+// defaultCloseGrace to complete before it is abandoned.
+func (session *Session) Close(reason error) {
+	session.closeWithDeadline(reason, time.Now().Add(defaultCloseGrace))
+}
+
+// closeWithDeadline is Close with an explicit limit for finishing a partially
+// received frame. A zero deadline waits for the frame without limit.
+func (session *Session) closeWithDeadline(reason error, deadline time.Time) {
+	session.closeOnce.Do(func() {
+		session.setDisconnectReason(reason)
+
+		session.frameMutex.Lock()
+		defer session.frameMutex.Unlock()
+
+		close(session.closing)
+		session.closeDeadline = deadline
+
+		if session.inFrame {
+			session.socket.conn.SetReadDeadline(deadline)
+		} else {
+			session.socket.conn.SetReadDeadline(time.Now())
+		}
+	})
+}
+
+// beginFrame runs between frames. It reports false once the session is
+// closing and no bytes of a further frame have been buffered yet.
+func (session *Session) beginFrame() (bool, error) {
+	session.frameMutex.Lock()
+	defer session.frameMutex.Unlock()
+
+	session.inFrame = session.reader.buffered() > 0
+
+	if session.isClosing() {
+		return session.inFrame, nil
+	}
+
+	err := session.setReadDeadline()
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (session *Session) onBytesIn(size int) {
+	session.stats.addBytesIn(size)
+
+	session.frameMutex.Lock()
+	defer session.frameMutex.Unlock()
+
+	if session.inFrame {
+		return
+	}
+
+	session.inFrame = true
+
+	if session.isClosing() {
+		session.socket.conn.SetReadDeadline(session.closeDeadline)
+	}
+}
+
+func (session *Session) Done() <-chan struct{} {
+	return session.done
+}
+
+func (session *Session) isStopped() bool {
+	select {
+	case <-session.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (session *Session) isClosing() bool {
+	select {
+	case <-session.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+func (session *Session) setDisconnectReason(reason error) {
+	session.reasonMutex.Lock()
+	defer session.reasonMutex.Unlock()
+
+	if session.reason == nil {
+		session.reason = reason
+	}
+}
+
+func (session *Session) GetDisconnectReason() DisconnectReason {
+	session.reasonMutex.Lock()
+	defer session.reasonMutex.Unlock()
+
+	return NewDisconnectReason(session.reason)
 }
 
 func (session *Session) doRecvPacket() {
+	err := session.recvPackets()
+
+	if err != nil && !session.isStopped() && !session.isClosing() {
+		session.reportError(err)
+	}
+
+	if err != nil {
+		session.setDisconnectReason(err)
+	}
+
+	if errors.Is(err, ErrProtocolViolation) {
+		session.sendProtocolError(err)
+	}
+
+	if session.isClosing() {
+		session.sendQueue.closeWrite()
+		<-session.sendDone
+	}
+
+	session.Stop()
+	<-session.sendDone
+	session.OnDisconnected(session, session.GetDisconnectReason())
+
+	for _, hook := range session.disconnectHooks {
+		hook(session)
+	}
+
+	close(session.done)
+}
+
+func (session *Session) recvPackets() error {
+	session.reader = newBufferedConn(session.socket.conn, session.readBufferSize, session.onBytesIn)
+	callbackFramer, recyclePackets := session.framer.(*packetCallbackFramer)
+	recyclePackets = recyclePackets && session.reuseReadBuffers
+
 	for {
-		select {
-		case <-session.stop:
-			return
-		default:
-			packetSize, err := session.OnParsePacketHeader(session.socket.conn, session.maxRecvBuffSize)
+		if session.isStopped() {
+			return nil
+		}
+
+		ok, err := session.beginFrame()
+
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return nil
+		}
+
+		packet, err := session.framer.ReadFrame(session.reader, session.maxRecvBuffSize)
+
+		if errors.Is(err, ErrPacketTooLarge) || errors.Is(err, ErrInvalidPacketSize) {
+			atomic.AddUint64(&session.stats.rejectedPackets, 1)
+		}
+
+		if err != nil {
+			return session.readTimeoutReason(err)
+		}
+
+		session.stats.addPacketIn()
+
+		control := callbackFramer != nil && callbackFramer.control
+
+		if !session.handleHeartbeat(packet, control) {
+			accepted, err := session.limitRecvRate(len(packet))
 
 			if err != nil {
-				session.OnError(session, err)
-				session.Stop()
-				session.OnDisconnected(session)
-				return
+				return err
 			}
 
-			packet, err := parsePacketBody(session.socket.conn, packetSize)
+			if accepted {
+				session.handlePacket(packet)
+			}
+		}
 
-			if err != nil {
-				session.OnError(session, err)
-				session.Stop()
-				session.OnDisconnected(session)
-				return
+		if recyclePackets {
+			putBuffer(packet)
+		}
+	}
+}
+
+func (session *Session) handlePacket(packet []byte) {
+	if session.metrics == nil {
+		session.OnRead(session, packet, len(packet))
+		session.dispatchMessage(packet)
+		return
+	}
+
+	session.metrics.observeFrameIn(len(packet))
+	startTime := time.Now()
+	session.OnRead(session, packet, len(packet))
+	session.dispatchMessage(packet)
+	session.metrics.observeHandler(time.Since(startTime))
+}
+
+func (session *Session) sendProtocolError(err error) {
+	if len(session.protocolErrorFrame) == 0 || session.isStopped() {
+		return
+	}
+
+	session.enqueue(session.protocolErrorFrame, false)
+	session.Close(err)
+}
+
+func (session *Session) dispatchMessage(packet []byte) {
+	codec := session.GetCodec()
+
+	if codec == nil || session.OnMessage == nil {
+		return
+	}
+
+	msg, err := codec.Decode(packet)
+
+	if err != nil {
+		session.reportError(err)
+		return
+	}
+
+	session.OnMessage(session, msg)
+}
+
+func (session *Session) addDisconnectHook(hook func(session *Session)) {
+	session.disconnectHooks = append(session.disconnectHooks, hook)
+}
+
+func (session *Session) doSendPacket() {
+	defer close(session.sendDone)
+
+	packets := make([]outboundPacket, 0, session.maxBatchSize)
+	buffers := make(net.Buffers, 0, session.maxBatchSize*2)
+
+	for {
+		var ok bool
+		packets, ok = session.sendQueue.popBatch(packets[:0], session.maxBatchSize)
+
+		if !ok {
+			return
+		}
+
+		packets = session.waitForBatch(packets)
+		buffers = buffers[:0]
+
+		for _, packet := range packets {
+			if len(packet.header) > 0 {
+				buffers = append(buffers, packet.header)
+			}
+
+			buffers = append(buffers, packet.payload)
+		}
+
+		if session.writeTimeout > 0 {
+			session.socket.conn.SetWriteDeadline(time.Now().Add(session.writeTimeout))
+		}
+
+		_, err := session.socket.SendBuffers(buffers)
+
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			err = ErrWriteTimeout
+		}
+
+		for i, packet := range packets {
+			packet.release()
+
+			if err == nil {
+				session.stats.addPacketOut(packet.size())
+
+				if session.metrics != nil {
+					session.metrics.observeFrameOut(packet.size())
+				}
+				session.OnWrite(session, packet.size())
+			}
+
+			packets[i] = outboundPacket{}
+		}
+
+		if err != nil {
+			if !session.isStopped() {
+				session.reportError(err)
 			}
 
-			session.OnRead(session, packet, packetSize)
+			session.stopWithReason(err)
+			return
 		}
 	}
 }
 
+func (session *Session) waitForBatch(packets []outboundPacket) []outboundPacket {
+	if session.flushInterval <= 0 || len(packets) >= session.maxBatchSize {
+		return packets
+	}
+
+	timer := time.NewTimer(session.flushInterval)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-session.stop:
+	case <-session.closing:
+	}
+
+	return session.sendQueue.tryPopBatch(packets, session.maxBatchSize-len(packets))
+}
+
+func (session *Session) GetID() uint64 {
+	return session.id
+}
+
+func (session *Session) GetSocket() *Socket {
+	return session.socket
+}
+
+func (session *Session) GetRejectedPackets() uint64 {
+	return atomic.LoadUint64(&session.stats.rejectedPackets)
+}
+
+func (session *Session) Stats() SessionStats {
+	return session.stats.snapshot()
+}
+
+func (session *Session) reportError(err error) {
+	atomic.AddUint64(&session.stats.errors, 1)
+	session.OnError(session, err)
+}
+
 func (session *Session) GetMaxRecvBuffSize() int {
 	return session.maxRecvBuffSize
 }
@@ -138,18 +568,103 @@ func (session *Session) GetMaxSendBuffSize() int {
 	return session.maxSendBuffSize
 }
 
-func (session *Session) SendPacket(data []byte) {
-	packet := session.OnBuildPacket(data)
-	session.socket.SendPacket(packet)
+// SetCodec replaces the codec. It is safe to call while the session is
+// running; packets already being decoded finish with the previous codec.
+func (session *Session) SetCodec(codec Codec) {
+	session.codecMutex.Lock()
+	defer session.codecMutex.Unlock()
+
+	session.codec = codec
+}
+
+func (session *Session) GetCodec() Codec {
+	session.codecMutex.RLock()
+	defer session.codecMutex.RUnlock()
+
+	return session.codec
+}
+
+func (session *Session) Send(msg interface{}) error {
+	codec := session.GetCodec()
+
+	if codec == nil {
+		return ErrNoCodec
+	}
+
+	data, err := codec.Encode(msg)
+
+	if err != nil {
+		return err
+	}
+
+	return session.SendPacket(data)
+}
+
+// SendPacket queues data for the writer goroutine without copying it when the
+// built-in framing is used, so data must not be modified after the call.
+func (session *Session) SendPacket(data []byte) error {
+	return session.sendPacket(data, session.sendQueueFullPolicy == SendQueueFullBlock)
+}
+
+func (session *Session) sendPacket(data []byte, block bool) error {
+	err := session.enqueue(data, block)
+
+	if err == ErrSendQueueFull && session.sendQueueFullPolicy == SendQueueFullDisconnect {
+		session.reportError(err)
+		session.stopWithReason(err)
+	}
+
+	return err
+}
+
+func (session *Session) enqueue(data []byte, block bool) error {
+	checker, ok := session.framer.(frameChecker)
+
+	if ok {
+		err := checker.checkFrame(data)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	packet := outboundPacket{}
+	framer, ok := session.framer.(*packetCallbackFramer)
+
+	if ok {
+		packet = framer.buildOutboundPacket(data)
+	} else {
+		packet.payload = session.framer.BuildFrame(data)
+	}
+
+	err := session.sendQueue.push(packet, block)
+
+	if err != nil {
+		packet.release()
+	}
+
+	return err
 }
 
 func NewSession(settings SessionSettings, s *Socket) *Session {
 	session := &Session{
+		id: atomic.AddUint64(&nextSessionID, 1),
 		socket: s,
 		stop: make(chan struct{}),
+		closing: make(chan struct{}),
+		sendDone: make(chan struct{}),
+		done: make(chan struct{}),
 	}
 
+	session.stats.connectTime = time.Now().UnixNano()
 	session.SetSessionSetting(settings)
+	session.sendQueue = newSendQueue(session.maxSendBuffSize)
 
 	return session
 }
+
+// NewSessionFromConn creates a session over an arbitrary net.Conn, including
+// Unix sockets and in-memory net.Pipe connections. The session is not started.
+func NewSessionFromConn(settings SessionSettings, conn net.Conn) *Session {
+	return NewSession(settings, NewSocket(conn))
+}
@@ -0,0 +1,87 @@
+package network
+
+import (
+	"sync"
+)
+
+type sessionManager struct {
+	mutex    sync.RWMutex
+	sessions map[uint64]*Session
+}
+
+func (manager *sessionManager) add(session *Session) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	manager.sessions[session.GetID()] = session
+}
+
+func (manager *sessionManager) remove(session *Session) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	delete(manager.sessions, session.GetID())
+}
+
+func (manager *sessionManager) get(id uint64) (*Session, bool) {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+
+	session, ok := manager.sessions[id]
+
+	return session, ok
+}
+
+func (manager *sessionManager) list() []*Session {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+
+	sessions := make([]*Session, 0, len(manager.sessions))
+
+	for _, session := range manager.sessions {
+		sessions = append(sessions, session)
+	}
+
+	return sessions
+}
+
+func (manager *sessionManager) count() int {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+
+	return len(manager.sessions)
+}
+
+// broadcast never blocks on a full send queue, so one slow session cannot
+// stall delivery to the others. Sessions whose queue is full are dropped or
+// disconnected according to their policy, with SendQueueFullBlock treated as
+// drop. It returns the sessions the packet could not be queued for.
+func (manager *sessionManager) broadcast(data []byte, except map[uint64]bool) []*Session {
+	var failed []*Session
+
+	for _, session := range manager.list() {
+		if except[session.GetID()] {
+			continue
+		}
+
+		err := session.sendPacket(data, false)
+
+		if err != nil {
+			failed = append(failed, session)
+		}
+	}
+
+	return failed
+}
+
+func (manager *sessionManager) closeAll() {
+	for _, session := range manager.list() {
+		session.Stop()
+	}
+}
+
+func newSessionManager() *sessionManager {
+	return &sessionManager{
+		sessions: map[uint64]*Session{},
+	}
+}
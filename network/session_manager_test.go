@@ -0,0 +1,55 @@
+package network
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func newPipeSession(t *testing.T, settings SessionSettings) (*Session, net.Conn) {
+	t.Helper()
+
+	local, remote := net.Pipe()
+	session := NewSessionFromConn(settings, local)
+	session.Start()
+
+	t.Cleanup(func() {
+		session.Stop()
+		remote.Close()
+	})
+
+	return session, remote
+}
+
+func TestBroadcastDoesNotBlockOnSlowSession(t *testing.T) {
+	slow, _ := newPipeSession(t, SessionSettings{MaxSendBuffSize: 16})
+	fast, fastPeer := newPipeSession(t, SessionSettings{})
+
+	go io.Copy(io.Discard, fastPeer)
+
+	manager := newSessionManager()
+	manager.add(slow)
+	manager.add(fast)
+
+	done := make(chan []*Session, 1)
+
+	go func() {
+		var failed []*Session
+
+		for i := 0; i < 5; i++ {
+			failed = manager.broadcast([]byte("0123456789"), nil)
+		}
+
+		done <- failed
+	}()
+
+	select {
+	case failed := <-done:
+		if len(failed) != 1 || failed[0] != slow {
+			t.Fatalf("failed sessions = %v, want only the slow session", failed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("broadcast blocked on a slow session")
+	}
+}
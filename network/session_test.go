@@ -0,0 +1,97 @@
+package network
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCloseCompletesPartialFrame(t *testing.T) {
+	received := make(chan []byte, 1)
+	session, peer := newPipeSession(t, SessionSettings{
+		OnRead: func(session *Session, data []byte, size int) {
+			received <- append([]byte(nil), data[:size]...)
+		},
+	})
+
+	payload := []byte("0123456789")
+	frame := buildPacket(payload)
+
+	_, err := peer.Write(frame[:7])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	session.Close(errors.New("closing"))
+
+	_, err = peer.Write(frame[7:])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case data := <-received:
+		if !bytes.Equal(data, payload) {
+			t.Fatalf("received %q, want %q", data, payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("partial frame was dropped on Close")
+	}
+
+	select {
+	case <-session.Done():
+	case <-time.After(time.Second):
+		t.Fatal("session did not disconnect after the frame completed")
+	}
+}
+
+func TestCloseInterruptsIdleRead(t *testing.T) {
+	session, _ := newPipeSession(t, SessionSettings{})
+
+	session.Close(errors.New("closing"))
+
+	select {
+	case <-session.Done():
+	case <-time.After(time.Second):
+		t.Fatal("idle session did not disconnect on Close")
+	}
+}
+
+func TestCloseAbandonsStalledFrameAtDeadline(t *testing.T) {
+	session, peer := newPipeSession(t, SessionSettings{})
+
+	_, err := peer.Write(buildPacket([]byte("0123456789"))[:7])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	session.closeWithDeadline(errors.New("closing"), time.Now().Add(time.Millisecond*100))
+
+	select {
+	case <-session.Done():
+	case <-time.After(time.Second):
+		t.Fatal("stalled frame held the session past its close deadline")
+	}
+}
+
+func TestSendPacketRejectsEmptyPayload(t *testing.T) {
+	session, _ := newPipeSession(t, SessionSettings{})
+
+	for _, data := range [][]byte{nil, {}} {
+		err := session.SendPacket(data)
+
+		if !errors.Is(err, ErrInvalidPacketSize) {
+			t.Fatalf("SendPacket(%v) = %v, want %v", data, err, ErrInvalidPacketSize)
+		}
+	}
+
+	if session.isStopped() {
+		t.Fatal("rejecting an empty payload stopped the session")
+	}
+}
@@ -1,12 +1,11 @@
 package network
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/binary"
-	"errors"
-	"io"
 	"net"
 	"strconv"
-	"strings"
 )
 
 type Socket struct {
@@ -66,23 +65,87 @@ func (s *Socket) GetRemoteAddress() string {
 	return s.conn.RemoteAddr().String()
 }
 
+func (s *Socket) IsTLS() bool {
+	_, ok := s.conn.(*tls.Conn)
+
+	return ok
+}
+
+func (s *Socket) GetPeerCertificates() []*x509.Certificate {
+	tlsConn, ok := s.conn.(*tls.Conn)
+
+	if !ok {
+		return nil
+	}
+
+	return tlsConn.ConnectionState().PeerCertificates
+}
+
+func (s *Socket) GetPeerCertificate() *x509.Certificate {
+	certificates := s.GetPeerCertificates()
+
+	if len(certificates) == 0 {
+		return nil
+	}
+
+	return certificates[0]
+}
+
 func (s *Socket) Close() error {
 	return s.conn.Close()
 }
 
 func (s *Socket) ReadSome(size int) ([]byte, error) {
 	packet := make([]byte, size)
-	n, err := io.ReadFull(s.conn, packet)
+	err := readFull(s.conn, packet)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if n != len(packet) {
-		return nil, errors.New("")
+	return packet, nil
+}
+
+func (s *Socket) SendBuffers(buffers net.Buffers) (int, error) {
+	total := 0
+
+	for _, buffer := range buffers {
+		total += len(buffer)
 	}
 
-	return packet, nil
+	if !supportsVectoredWrite(s.conn) {
+		packet := getBuffer(total)
+		defer putBuffer(packet)
+
+		offset := 0
+
+		for _, buffer := range buffers {
+			offset += copy(packet[offset:], buffer)
+		}
+
+		return s.SendPacket(packet)
+	}
+
+	size, err := buffers.WriteTo(s.conn)
+
+	if err != nil {
+		return int(size), err
+	}
+
+	if int(size) != total {
+		return int(size), &ShortWriteError{Expected: total, Actual: int(size)}
+	}
+
+	return int(size), nil
+}
+
+func supportsVectoredWrite(conn net.Conn) bool {
+	switch conn.(type) {
+	case *net.TCPConn, *net.UnixConn:
+		return true
+	default:
+		return false
+	}
 }
 
 func (s *Socket) SendPacket(data []byte) (int, error) {
@@ -93,42 +156,79 @@ func (s *Socket) SendPacket(data []byte) (int, error) {
 	}
 
 	if size != len(data) {
-		return size, errors.New("")
+		return size, &ShortWriteError{Expected: len(data), Actual: size}
 	}
 
 	return size, nil
 }
 
 func parsePacketHeader(conn net.Conn, maxRecvBuffSize int) (int, error) {
-	packetHeader := make([]byte, 4)
-	size, err := io.ReadFull(conn, packetHeader)
+	packetSize, control, err := parseFrameHeader(conn, maxRecvBuffSize)
+
+	if err == nil && control {
+		err = &PacketSizeError{Size: packetSize | controlFrameFlag, Limit: maxRecvBuffSize}
+	}
 
 	if err != nil {
 		return 0, err
 	}
 
-	if size != 4 {
-		return size, errors.New("")
+	return packetSize, nil
+}
+
+// parseFrameHeader reads the built-in 4-byte header, whose top bit marks
+// session control frames such as heartbeats.
+func parseFrameHeader(conn net.Conn, maxRecvBuffSize int) (int, bool, error) {
+	packetHeader := getBuffer(4)
+	defer putBuffer(packetHeader)
+
+	err := readFull(conn, packetHeader)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	header := binary.BigEndian.Uint32(packetHeader)
+	packetSize := int(header &^ controlFrameFlag)
+	err = checkPacketSize(packetSize, maxRecvBuffSize)
+
+	if err != nil {
+		return 0, false, err
 	}
 
-	return int(binary.BigEndian.Uint32(packetHeader)), nil
+	return packetSize, header&controlFrameFlag != 0, nil
 }
 
 func parsePacketBody(conn net.Conn, packetSize int) ([]byte, error) {
 	packet := make([]byte, packetSize)
-	size, err := io.ReadFull(conn, packet)
+	err := readFull(conn, packet)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if size != packetSize {
-		return nil, errors.New("")
+	return packet, nil
+}
+
+func parsePooledPacketBody(conn net.Conn, packetSize int) ([]byte, error) {
+	packet := getBuffer(packetSize)
+	err := readFull(conn, packet)
+
+	if err != nil {
+		putBuffer(packet)
+		return nil, err
 	}
 
 	return packet, nil
 }
 
+func buildPooledPacketHeader(data []byte) []byte {
+	header := getBuffer(4)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+
+	return header
+}
+
 func buildPacket(data []byte) []byte {
 	packetSize := len(data)
 	totalPacketSize := 4 + packetSize
@@ -139,20 +239,13 @@ func buildPacket(data []byte) []byte {
 	return packet
 }
 
+// NewSocket wraps any net.Conn. Addresses that are not host:port pairs, such
+// as Unix socket paths or net.Pipe ends, are kept verbatim as the host with a
+// zero port.
 func NewSocket(conn net.Conn) *Socket {
 	s := &Socket{}
-
-	localHost, localPort, err := SplitHostAndPort(conn.LocalAddr().String())
-
-	if err != nil {
-		return nil
-	}
-
-	remoteHost, remotePort, err := SplitHostAndPort(conn.RemoteAddr().String())
-
-	if err != nil {
-		return nil
-	}
+	localHost, localPort := splitAddr(conn.LocalAddr())
+	remoteHost, remotePort := splitAddr(conn.RemoteAddr())
 
 	s.conn = conn
 	s.LocalHost = localHost
@@ -163,21 +256,40 @@ func NewSocket(conn net.Conn) *Socket {
 	return s
 }
 
+func splitAddr(address net.Addr) (string, int) {
+	if address == nil {
+		return "", 0
+	}
+
+	host, port, err := SplitHostAndPort(address.String())
+
+	if err != nil {
+		return address.String(), 0
+	}
+
+	return host, port
+}
+
+// ComposeAddressByHostAndPort joins a host and port, bracketing IPv6 hosts
+// such as "::1" or "fe80::1%eth0" as required by net.Dial and net.Listen.
 func ComposeAddressByHostAndPort(host string, port int) string {
-	return host + ":" + strconv.Itoa(port)
+	return net.JoinHostPort(host, strconv.Itoa(port))
 }
 
+// SplitHostAndPort splits "host:port", "[ipv6]:port" or "[ipv6%zone]:port"
+// into its host and numeric port. IPv6 hosts are returned without brackets.
 func SplitHostAndPort(address string) (string, int, error) {
-	addressParts := strings.Split(address, ":")
-	count := len(addressParts)
+	host, portText, err := net.SplitHostPort(address)
 
-	if count > 2 {
-		return "", 0, errors.New("too many parameters in address")
-	} else if count < 2 {
-		return "", 0, errors.New("missing port in address")
+	if err != nil {
+		return "", 0, err
 	}
 
-	port, _:= strconv.Atoi(addressParts[1])
+	port, err := strconv.Atoi(portText)
+
+	if err != nil || port < 0 || port > 65535 {
+		return "", 0, &net.AddrError{Err: "invalid port", Addr: address}
+	}
 
-	return addressParts[0], port, nil
+	return host, port, nil
 }
\ No newline at end of file
@@ -0,0 +1,168 @@
+package network
+
+import (
+	"net"
+	"testing"
+)
+
+var socketAddressTests = []struct {
+	name    string
+	address string
+	host    string
+	port    int
+}{
+	{"ipv4", "192.0.2.1:8080", "192.0.2.1", 8080},
+	{"ipv4 any", "0.0.0.0:0", "0.0.0.0", 0},
+	{"hostname", "localhost:443", "localhost", 443},
+	{"ipv6 loopback", "[::1]:9000", "::1", 9000},
+	{"ipv6 full", "[2001:db8::1]:65535", "2001:db8::1", 65535},
+	{"ipv6 zone", "[fe80::1%eth0]:7000", "fe80::1%eth0", 7000},
+	{"ipv4-mapped ipv6", "[::ffff:192.0.2.1]:80", "::ffff:192.0.2.1", 80},
+}
+
+func TestSplitHostAndPort(t *testing.T) {
+	for _, test := range socketAddressTests {
+		t.Run(test.name, func(t *testing.T) {
+			host, port, err := SplitHostAndPort(test.address)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if host != test.host || port != test.port {
+				t.Fatalf("SplitHostAndPort(%q) = %q, %d, want %q, %d", test.address, host, port, test.host, test.port)
+			}
+		})
+	}
+}
+
+func TestSplitHostAndPortErrors(t *testing.T) {
+	tests := []string{
+		"192.0.2.1",
+		"::1:80",
+		"[::1]",
+		"host:http",
+		"host:-1",
+		"host:65536",
+		"/tmp/app.sock",
+	}
+
+	for _, address := range tests {
+		_, _, err := SplitHostAndPort(address)
+
+		if err == nil {
+			t.Errorf("SplitHostAndPort(%q) succeeded, want error", address)
+		}
+	}
+}
+
+func TestComposeAddressByHostAndPort(t *testing.T) {
+	for _, test := range socketAddressTests {
+		t.Run(test.name, func(t *testing.T) {
+			address := ComposeAddressByHostAndPort(test.host, test.port)
+
+			if address != test.address {
+				t.Fatalf("ComposeAddressByHostAndPort(%q, %d) = %q, want %q", test.host, test.port, address, test.address)
+			}
+		})
+	}
+}
+
+type fakeAddr struct {
+	network string
+	address string
+}
+
+func (addr fakeAddr) Network() string {
+	return addr.network
+}
+
+func (addr fakeAddr) String() string {
+	return addr.address
+}
+
+type fakeAddrConn struct {
+	net.Conn
+	local  net.Addr
+	remote net.Addr
+}
+
+func (conn *fakeAddrConn) LocalAddr() net.Addr {
+	return conn.local
+}
+
+func (conn *fakeAddrConn) RemoteAddr() net.Addr {
+	return conn.remote
+}
+
+func TestNewSocket(t *testing.T) {
+	tests := []struct {
+		name       string
+		local      net.Addr
+		remote     net.Addr
+		localHost  string
+		localPort  int
+		remoteHost string
+		remotePort int
+	}{
+		{
+			name:       "ipv4",
+			local:      &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 8080},
+			remote:     &net.TCPAddr{IP: net.ParseIP("198.51.100.7"), Port: 50000},
+			localHost:  "192.0.2.1",
+			localPort:  8080,
+			remoteHost: "198.51.100.7",
+			remotePort: 50000,
+		},
+		{
+			name:       "ipv6",
+			local:      &net.TCPAddr{IP: net.ParseIP("::1"), Port: 9000},
+			remote:     &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 50001},
+			localHost:  "::1",
+			localPort:  9000,
+			remoteHost: "2001:db8::2",
+			remotePort: 50001,
+		},
+		{
+			name:       "ipv6 zone",
+			local:      &net.TCPAddr{IP: net.ParseIP("fe80::1"), Port: 7000, Zone: "eth0"},
+			remote:     &net.TCPAddr{IP: net.ParseIP("fe80::2"), Port: 50002, Zone: "eth0"},
+			localHost:  "fe80::1%eth0",
+			localPort:  7000,
+			remoteHost: "fe80::2%eth0",
+			remotePort: 50002,
+		},
+		{
+			name:       "unix",
+			local:      &net.UnixAddr{Name: "/tmp/app.sock", Net: "unix"},
+			remote:     &net.UnixAddr{Name: "@", Net: "unix"},
+			localHost:  "/tmp/app.sock",
+			remoteHost: "@",
+		},
+		{
+			name:       "pipe",
+			local:      fakeAddr{network: "pipe", address: "pipe"},
+			remote:     fakeAddr{network: "pipe", address: "pipe"},
+			localHost:  "pipe",
+			remoteHost: "pipe",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewSocket(&fakeAddrConn{local: test.local, remote: test.remote})
+
+			if s.GetLocalHost() != test.localHost || s.GetLocalPort() != test.localPort {
+				t.Errorf("local = %q, %d, want %q, %d", s.GetLocalHost(), s.GetLocalPort(), test.localHost, test.localPort)
+			}
+
+			if s.GetRemoteHost() != test.remoteHost || s.GetRemotePort() != test.remotePort {
+				t.Errorf("remote = %q, %d, want %q, %d", s.GetRemoteHost(), s.GetRemotePort(), test.remoteHost, test.remotePort)
+			}
+
+			if s.GetRemoteAddress() != test.remote.String() {
+				t.Errorf("remote address = %q, want %q", s.GetRemoteAddress(), test.remote.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package network
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type SessionStats struct {
+	BytesIn            uint64
+	BytesOut           uint64
+	PacketsIn          uint64
+	PacketsOut         uint64
+	Errors             uint64
+	RejectedPackets    uint64
+	RateLimitedPackets uint64
+	ConnectTime        time.Time
+	LastReadTime       time.Time
+	LastWriteTime      time.Time
+}
+
+type AcceptorStats struct {
+	Accepted   uint64
+	Active     uint64
+	Rejected   uint64
+	BytesIn    uint64
+	BytesOut   uint64
+	PacketsIn  uint64
+	PacketsOut uint64
+}
+
+type ConnectorStats struct {
+	State             ConnectorState
+	Connects          uint64
+	ReconnectAttempts uint64
+	BytesIn           uint64
+	BytesOut          uint64
+	PacketsIn         uint64
+	PacketsOut        uint64
+}
+
+type trafficCounters struct {
+	bytesIn    uint64
+	bytesOut   uint64
+	packetsIn  uint64
+	packetsOut uint64
+}
+
+type sessionCounters struct {
+	trafficCounters
+
+	errors             uint64
+	rejectedPackets    uint64
+	rateLimitedPackets uint64
+	connectTime        int64
+	lastReadTime       int64
+	lastWriteTime      int64
+	parent             *trafficCounters
+}
+
+func (counters *sessionCounters) addBytesIn(size int) {
+	atomic.AddUint64(&counters.bytesIn, uint64(size))
+	atomic.StoreInt64(&counters.lastReadTime, time.Now().UnixNano())
+
+	if counters.parent != nil {
+		atomic.AddUint64(&counters.parent.bytesIn, uint64(size))
+	}
+}
+
+func (counters *sessionCounters) addPacketIn() {
+	atomic.AddUint64(&counters.packetsIn, 1)
+
+	if counters.parent != nil {
+		atomic.AddUint64(&counters.parent.packetsIn, 1)
+	}
+}
+
+func (counters *sessionCounters) addPacketOut(size int) {
+	atomic.AddUint64(&counters.bytesOut, uint64(size))
+	atomic.AddUint64(&counters.packetsOut, 1)
+	atomic.StoreInt64(&counters.lastWriteTime, time.Now().UnixNano())
+
+	if counters.parent != nil {
+		atomic.AddUint64(&counters.parent.bytesOut, uint64(size))
+		atomic.AddUint64(&counters.parent.packetsOut, 1)
+	}
+}
+
+func (counters *sessionCounters) snapshot() SessionStats {
+	return SessionStats{
+		BytesIn:            atomic.LoadUint64(&counters.bytesIn),
+		BytesOut:           atomic.LoadUint64(&counters.bytesOut),
+		PacketsIn:          atomic.LoadUint64(&counters.packetsIn),
+		PacketsOut:         atomic.LoadUint64(&counters.packetsOut),
+		Errors:             atomic.LoadUint64(&counters.errors),
+		RejectedPackets:    atomic.LoadUint64(&counters.rejectedPackets),
+		RateLimitedPackets: atomic.LoadUint64(&counters.rateLimitedPackets),
+		ConnectTime:        unixNanoToTime(atomic.LoadInt64(&counters.connectTime)),
+		LastReadTime:       unixNanoToTime(atomic.LoadInt64(&counters.lastReadTime)),
+		LastWriteTime:      unixNanoToTime(atomic.LoadInt64(&counters.lastWriteTime)),
+	}
+}
+
+type acceptorCounters struct {
+	trafficCounters
+
+	accepted uint64
+	rejected uint64
+}
+
+func (counters *acceptorCounters) snapshot(active int) AcceptorStats {
+	return AcceptorStats{
+		Accepted:   atomic.LoadUint64(&counters.accepted),
+		Active:     uint64(active),
+		Rejected:   atomic.LoadUint64(&counters.rejected),
+		BytesIn:    atomic.LoadUint64(&counters.bytesIn),
+		BytesOut:   atomic.LoadUint64(&counters.bytesOut),
+		PacketsIn:  atomic.LoadUint64(&counters.packetsIn),
+		PacketsOut: atomic.LoadUint64(&counters.packetsOut),
+	}
+}
+
+type connectorCounters struct {
+	trafficCounters
+
+	connects          uint64
+	reconnectAttempts uint64
+}
+
+func (counters *connectorCounters) snapshot(state ConnectorState) ConnectorStats {
+	return ConnectorStats{
+		State:             state,
+		Connects:          atomic.LoadUint64(&counters.connects),
+		ReconnectAttempts: atomic.LoadUint64(&counters.reconnectAttempts),
+		BytesIn:           atomic.LoadUint64(&counters.bytesIn),
+		BytesOut:          atomic.LoadUint64(&counters.bytesOut),
+		PacketsIn:         atomic.LoadUint64(&counters.packetsIn),
+		PacketsOut:        atomic.LoadUint64(&counters.packetsOut),
+	}
+}
+
+func unixNanoToTime(nanoseconds int64) time.Time {
+	if nanoseconds == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanoseconds)
+}
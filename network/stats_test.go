@@ -0,0 +1,157 @@
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// waitUntil polls condition until it holds or a second has passed.
+func waitUntil(t *testing.T, condition func() bool) bool {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+
+	for !condition() {
+		if time.Now().After(deadline) {
+			return false
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	return true
+}
+
+func TestSessionStats(t *testing.T) {
+	read := make(chan struct{}, 1)
+	session, peer := newPipeSession(t, SessionSettings{
+		OnRead: func(session *Session, data []byte, size int) {
+			read <- struct{}{}
+		},
+	})
+
+	if session.Stats().ConnectTime.IsZero() {
+		t.Fatal("ConnectTime is not set on a started session")
+	}
+
+	go peer.Write(buildPacket([]byte("ping")))
+
+	select {
+	case <-read:
+	case <-time.After(time.Second):
+		t.Fatal("packet was not delivered")
+	}
+
+	err := session.SendPacket([]byte("pong!"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = readTestPacket(peer)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := waitUntil(t, func() bool {
+		return session.Stats().PacketsOut == 1
+	})
+
+	if !ok {
+		t.Fatal("PacketsOut was not counted")
+	}
+
+	stats := session.Stats()
+
+	if stats.PacketsIn != 1 || stats.BytesIn != 4+4 {
+		t.Fatalf("inbound stats = %d packets, %d bytes, want 1 packet, 8 bytes", stats.PacketsIn, stats.BytesIn)
+	}
+
+	if stats.BytesOut != 4+5 {
+		t.Fatalf("BytesOut = %d, want 9", stats.BytesOut)
+	}
+
+	if stats.LastReadTime.IsZero() || stats.LastWriteTime.IsZero() {
+		t.Fatalf("last read and write times = %v, %v, want both set", stats.LastReadTime, stats.LastWriteTime)
+	}
+
+	if stats.Errors != 0 {
+		t.Fatalf("Errors = %d, want 0", stats.Errors)
+	}
+}
+
+func TestSessionStatsCountErrors(t *testing.T) {
+	session, peer := newPipeSession(t, SessionSettings{MaxRecvBuffSize: 16})
+
+	go peer.Write(buildPacket(make([]byte, 32)))
+
+	ok := waitUntil(t, func() bool {
+		return session.Stats().Errors == 1
+	})
+
+	if !ok {
+		t.Fatalf("Errors = %d after an oversize packet, want 1", session.Stats().Errors)
+	}
+}
+
+func TestAcceptorStats(t *testing.T) {
+	acceptor, address := startTestAcceptor(t, AcceptorSettings{
+		SessionSettings: SessionSettings{
+			OnRead: func(session *Session, data []byte, size int) {
+				session.SendPacket(append([]byte(nil), data...))
+			},
+		},
+	})
+
+	conn, err := net.Dial("tcp", address)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.Write(buildPacket([]byte("ping")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = readTestPacket(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := waitUntil(t, func() bool {
+		return acceptor.Stats().PacketsOut == 1
+	})
+
+	if !ok {
+		t.Fatal("acceptor did not count the echoed packet")
+	}
+
+	stats := acceptor.Stats()
+
+	if stats.Accepted != 1 || stats.Active != 1 || stats.Rejected != 0 {
+		t.Fatalf("session stats = %d accepted, %d active, %d rejected, want 1, 1, 0", stats.Accepted, stats.Active, stats.Rejected)
+	}
+
+	if stats.PacketsIn != 1 || stats.BytesIn != 8 || stats.BytesOut != 8 {
+		t.Fatalf("traffic stats = %d packets in, %d bytes in, %d bytes out, want 1, 8, 8", stats.PacketsIn, stats.BytesIn, stats.BytesOut)
+	}
+
+	conn.Close()
+
+	ok = waitUntil(t, func() bool {
+		return acceptor.Stats().Active == 0
+	})
+
+	if !ok {
+		t.Fatal("Active did not drop after the client disconnected")
+	}
+
+	if acceptor.Stats().Accepted != 1 || acceptor.Stats().PacketsIn != 1 {
+		t.Fatal("totals changed after the session closed")
+	}
+}
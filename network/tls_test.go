@@ -0,0 +1,185 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T, commonName string) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func newMutualTLSConfigs(t *testing.T) (*tls.Config, *tls.Config) {
+	t.Helper()
+
+	serverCert, serverPool := newTestCertificate(t, "server")
+	clientCert, clientPool := newTestCertificate(t, "client")
+
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	clientConfig := &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      serverPool,
+	}
+
+	return serverConfig, clientConfig
+}
+
+func TestMutualTLS(t *testing.T) {
+	serverConfig, clientConfig := newMutualTLSConfigs(t)
+	accepted := make(chan *Session, 1)
+
+	_, address := startTestAcceptor(t, AcceptorSettings{
+		OnNewSession: func(acceptor *Acceptor, session *Session) {
+			accepted <- session
+		},
+		TLSConfig: serverConfig,
+	})
+
+	connector := NewConnector(ConnectorSettings{TLSConfig: clientConfig})
+
+	if !connector.DialNetwork("tcp", address) {
+		t.Fatal("mutual TLS connect failed")
+	}
+
+	defer connector.Stop()
+
+	peer := connector.GetSession().GetSocket().GetPeerCertificate()
+
+	if peer == nil || peer.Subject.CommonName != "server" {
+		t.Fatalf("connector peer certificate = %v, want server", peer)
+	}
+
+	select {
+	case session := <-accepted:
+		peer := session.GetSocket().GetPeerCertificate()
+
+		if peer == nil || peer.Subject.CommonName != "client" {
+			t.Fatalf("acceptor peer certificate = %v, want client", peer)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("acceptor did not create a session")
+	}
+}
+
+func TestMutualTLSRejectsClientWithoutCertificate(t *testing.T) {
+	serverConfig, clientConfig := newMutualTLSConfigs(t)
+	rejected := make(chan RejectReason, 1)
+
+	_, address := startTestAcceptor(t, AcceptorSettings{
+		OnReject: func(acceptor *Acceptor, remoteAddr net.Addr, reason RejectReason) {
+			rejected <- reason
+		},
+		TLSConfig: serverConfig,
+	})
+
+	clientConfig.Certificates = nil
+	connector := NewConnector(ConnectorSettings{TLSConfig: clientConfig})
+	connector.DialNetwork("tcp", address)
+	defer connector.Stop()
+
+	select {
+	case reason := <-rejected:
+		if reason != RejectHandshakeFailed {
+			t.Fatalf("reject reason = %v, want RejectHandshakeFailed", reason)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("acceptor did not reject a client without a certificate")
+	}
+}
+
+func TestConnectorHandshakeTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			defer conn.Close()
+		}
+	}()
+
+	_, clientConfig := newMutualTLSConfigs(t)
+	connector := NewConnector(ConnectorSettings{
+		TLSConfig:        clientConfig,
+		HandshakeTimeout: time.Millisecond * 100,
+	})
+	result := make(chan bool, 1)
+
+	go func() {
+		result <- connector.DialNetwork("tcp", listener.Addr().String())
+	}()
+
+	select {
+	case ok := <-result:
+		if ok {
+			t.Fatal("connect succeeded against a silent server")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("connect ignored HandshakeTimeout")
+	}
+}
+
+func TestGetPeerCertificateWithoutTLS(t *testing.T) {
+	session, _ := newPipeSession(t, SessionSettings{})
+
+	if session.GetSocket().GetPeerCertificate() != nil {
+		t.Fatal("plain connection reported a peer certificate")
+	}
+}
@@ -0,0 +1,296 @@
+package network
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type udpAcceptorListenFunc func(acceptor *UDPAcceptor)
+type udpAcceptorNewSessionFunc func(acceptor *UDPAcceptor, session *Session)
+type udpAcceptorErrorFunc func(acceptor *UDPAcceptor, err error)
+type udpAcceptorRejectFunc func(acceptor *UDPAcceptor, remoteAddr net.Addr, reason RejectReason)
+
+// UDPAcceptorSettings configures a UDPAcceptor. Each remote address gets a
+// virtual Session that receives one OnRead call per datagram. Sessions that
+// receive nothing for IdleTimeout are disconnected with ErrIdleTimeout unless
+// SessionSettings.ReadIdleTimeout overrides it. Datagrams larger than
+// MaxDatagramSize are dropped and packets larger than it cannot be sent.
+// Datagrams from a new address are dropped and reported to OnReject while
+// MaxSessions or MaxSessionsPerIP is reached.
+type UDPAcceptorSettings struct {
+	OnListen     udpAcceptorListenFunc
+	OnNewSession udpAcceptorNewSessionFunc
+	OnError      udpAcceptorErrorFunc
+	OnReject     udpAcceptorRejectFunc
+
+	SessionSettings  SessionSettings
+	MaxDatagramSize  int
+	IdleTimeout      time.Duration
+	ReceiveQueueSize int
+	MaxSessions      int
+	MaxSessionsPerIP int
+}
+
+type UDPAcceptor struct {
+	stats      acceptorCounters
+	stop       chan struct{}
+	stopOnce   sync.Once
+	acceptDone chan struct{}
+	conn       *net.UDPConn
+	sessions   *sessionManager
+	peerMutex  sync.Mutex
+	peers      map[string]*udpConn
+	limiter    *connectionLimiter
+
+	onListen     udpAcceptorListenFunc
+	onNewSession udpAcceptorNewSessionFunc
+	onError      udpAcceptorErrorFunc
+	onReject     udpAcceptorRejectFunc
+
+	sessionSettings  SessionSettings
+	maxDatagramSize  int
+	idleTimeout      time.Duration
+	receiveQueueSize int
+}
+
+func (acceptor *UDPAcceptor) SetUDPAcceptorSettings(settings UDPAcceptorSettings) {
+	acceptor.onListen = settings.OnListen
+	acceptor.onNewSession = settings.OnNewSession
+	acceptor.onError = settings.OnError
+	acceptor.onReject = settings.OnReject
+	acceptor.limiter.configure(settings.MaxSessions, settings.MaxSessionsPerIP, 0, 0)
+	acceptor.sessionSettings = settings.SessionSettings
+	acceptor.maxDatagramSize = normalizeMaxDatagramSize(settings.MaxDatagramSize)
+	acceptor.idleTimeout = settings.IdleTimeout
+	acceptor.receiveQueueSize = settings.ReceiveQueueSize
+
+	if acceptor.onListen == nil {
+		acceptor.onListen = func(acceptor *UDPAcceptor) {
+		}
+	}
+
+	if acceptor.onNewSession == nil {
+		acceptor.onNewSession = func(acceptor *UDPAcceptor, session *Session) {
+		}
+	}
+
+	if acceptor.onError == nil {
+		acceptor.onError = func(acceptor *UDPAcceptor, err error) {
+		}
+	}
+
+	if acceptor.onReject == nil {
+		acceptor.onReject = func(acceptor *UDPAcceptor, remoteAddr net.Addr, reason RejectReason) {
+		}
+	}
+
+	if acceptor.idleTimeout <= 0 {
+		acceptor.idleTimeout = defaultUDPIdleTimeout
+	}
+
+	if acceptor.receiveQueueSize <= 0 {
+		acceptor.receiveQueueSize = defaultUDPReceiveQueue
+	}
+
+	if acceptor.sessionSettings.ReadIdleTimeout <= 0 {
+		acceptor.sessionSettings.ReadIdleTimeout = acceptor.idleTimeout
+	}
+}
+
+func (acceptor *UDPAcceptor) Start(host string, port int) bool {
+	return acceptor.Listen("udp", ComposeAddressByHostAndPort(host, port))
+}
+
+// Listen binds a UDP socket on network "udp", "udp4" or "udp6" and serves it
+// in the background.
+func (acceptor *UDPAcceptor) Listen(network string, address string) bool {
+	udpAddr, err := net.ResolveUDPAddr(network, address)
+
+	if err != nil {
+		acceptor.onError(acceptor, err)
+		return false
+	}
+
+	conn, err := net.ListenUDP(network, udpAddr)
+
+	if err != nil {
+		acceptor.onError(acceptor, err)
+		return false
+	}
+
+	return acceptor.Serve(conn)
+}
+
+// Serve reads datagrams from an existing UDP socket in the background. The
+// acceptor takes ownership of the socket and closes it on Stop.
+func (acceptor *UDPAcceptor) Serve(conn *net.UDPConn) bool {
+	acceptor.conn = conn
+	go acceptor.doRead()
+	acceptor.onListen(acceptor)
+
+	return true
+}
+
+func (acceptor *UDPAcceptor) doRead() {
+	defer close(acceptor.acceptDone)
+
+	buffer := make([]byte, acceptor.maxDatagramSize+1)
+
+	for {
+		size, remoteAddr, err := acceptor.conn.ReadFromUDP(buffer)
+
+		if err != nil {
+			if acceptor.isStopped() {
+				return
+			}
+
+			if isTemporary(err) {
+				acceptor.onError(acceptor, err)
+				continue
+			}
+
+			acceptor.onError(acceptor, err)
+			acceptor.conn.Close()
+			return
+		}
+
+		if size > acceptor.maxDatagramSize {
+			atomic.AddUint64(&acceptor.stats.rejected, 1)
+			continue
+		}
+
+		datagram := make([]byte, size)
+		copy(datagram, buffer[:size])
+		acceptor.dispatch(remoteAddr, datagram)
+	}
+}
+
+func (acceptor *UDPAcceptor) dispatch(remoteAddr *net.UDPAddr, datagram []byte) {
+	key := remoteAddr.String()
+
+	acceptor.peerMutex.Lock()
+	peer, ok := acceptor.peers[key]
+
+	if !ok {
+		reason, admitted := acceptor.limiter.admit(remoteIP(remoteAddr))
+
+		if !admitted {
+			acceptor.peerMutex.Unlock()
+			atomic.AddUint64(&acceptor.stats.rejected, 1)
+			acceptor.onReject(acceptor, remoteAddr, reason)
+			return
+		}
+
+		peer = newUDPConn(acceptor.conn, remoteAddr, acceptor.receiveQueueSize, acceptor.removePeer)
+		acceptor.peers[key] = peer
+	}
+
+	acceptor.peerMutex.Unlock()
+
+	if !ok {
+		acceptor.newSession(peer)
+	}
+
+	if !peer.deliver(datagram) {
+		atomic.AddUint64(&acceptor.stats.rejected, 1)
+	}
+}
+
+func (acceptor *UDPAcceptor) removePeer(conn *udpConn) {
+	acceptor.peerMutex.Lock()
+	defer acceptor.peerMutex.Unlock()
+
+	acceptor.limiter.release(remoteIP(conn.remoteAddr))
+
+	key := conn.remoteAddr.String()
+
+	if acceptor.peers[key] == conn {
+		delete(acceptor.peers, key)
+	}
+}
+
+func (acceptor *UDPAcceptor) newSession(conn *udpConn) {
+	session := newDatagramSession(acceptor.sessionSettings, conn, acceptor.maxDatagramSize)
+	session.stats.parent = &acceptor.stats.trafficCounters
+	atomic.AddUint64(&acceptor.stats.accepted, 1)
+	session.addDisconnectHook(acceptor.sessions.remove)
+	acceptor.sessions.add(session)
+	acceptor.onNewSession(acceptor, session)
+	session.Start()
+}
+
+func (acceptor *UDPAcceptor) Stop() {
+	acceptor.stopOnce.Do(func() {
+		close(acceptor.stop)
+
+		if acceptor.conn != nil {
+			acceptor.conn.Close()
+			<-acceptor.acceptDone
+		}
+	})
+
+	acceptor.sessions.closeAll()
+}
+
+func (acceptor *UDPAcceptor) isStopped() bool {
+	select {
+	case <-acceptor.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (acceptor *UDPAcceptor) GetLocalAddress() string {
+	if acceptor.conn == nil {
+		return ""
+	}
+
+	return acceptor.conn.LocalAddr().String()
+}
+
+func (acceptor *UDPAcceptor) Sessions() []*Session {
+	return acceptor.sessions.list()
+}
+
+func (acceptor *UDPAcceptor) Get(id uint64) (*Session, bool) {
+	return acceptor.sessions.get(id)
+}
+
+func (acceptor *UDPAcceptor) Count() int {
+	return acceptor.sessions.count()
+}
+
+func (acceptor *UDPAcceptor) Broadcast(data []byte) []*Session {
+	return acceptor.sessions.broadcast(data, nil)
+}
+
+func (acceptor *UDPAcceptor) Stats() AcceptorStats {
+	return acceptor.stats.snapshot(acceptor.sessions.count())
+}
+
+func (acceptor *UDPAcceptor) CloseAll() {
+	acceptor.sessions.closeAll()
+}
+
+func isTemporary(err error) bool {
+	netErr, ok := err.(net.Error)
+
+	return ok && netErr.Temporary()
+}
+
+func NewUDPAcceptor(settings UDPAcceptorSettings) *UDPAcceptor {
+	acceptor := &UDPAcceptor{
+		stop:       make(chan struct{}),
+		acceptDone: make(chan struct{}),
+		sessions:   newSessionManager(),
+		peers:      map[string]*udpConn{},
+		limiter:    newConnectionLimiter(),
+	}
+
+	acceptor.SetUDPAcceptorSettings(settings)
+
+	return acceptor
+}
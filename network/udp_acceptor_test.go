@@ -0,0 +1,248 @@
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func startTestUDPAcceptor(t *testing.T, settings UDPAcceptorSettings) *UDPAcceptor {
+	t.Helper()
+
+	acceptor := NewUDPAcceptor(settings)
+
+	if !acceptor.Listen("udp", "127.0.0.1:0") {
+		t.Fatal("UDP acceptor failed to listen")
+	}
+
+	t.Cleanup(acceptor.Stop)
+
+	return acceptor
+}
+
+func dialTestUDPClient(t *testing.T, acceptor *UDPAcceptor) *net.UDPConn {
+	t.Helper()
+
+	serverAddr, err := net.ResolveUDPAddr("udp", acceptor.GetLocalAddress())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.DialUDP("udp", nil, serverAddr)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	return conn
+}
+
+func readTestDatagram(t *testing.T, conn *net.UDPConn) string {
+	t.Helper()
+
+	buffer := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	size, err := conn.Read(buffer)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(buffer[:size])
+}
+
+func udpEchoSettings() UDPAcceptorSettings {
+	return UDPAcceptorSettings{
+		SessionSettings: SessionSettings{
+			OnRead: func(session *Session, data []byte, size int) {
+				session.SendPacket(append([]byte(nil), data...))
+			},
+		},
+	}
+}
+
+func TestUDPAcceptorEcho(t *testing.T) {
+	acceptor := startTestUDPAcceptor(t, udpEchoSettings())
+	client := dialTestUDPClient(t, acceptor)
+
+	for _, message := range []string{"ping", "pong"} {
+		_, err := client.Write([]byte(message))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		echo := readTestDatagram(t, client)
+
+		if echo != message {
+			t.Fatalf("echo = %q, want %q", echo, message)
+		}
+	}
+
+	if acceptor.Count() != 1 {
+		t.Fatalf("Count = %d after two datagrams from one peer, want 1", acceptor.Count())
+	}
+}
+
+func TestUDPAcceptorDemuxesPeers(t *testing.T) {
+	acceptor := startTestUDPAcceptor(t, udpEchoSettings())
+	clients := make([]*net.UDPConn, 3)
+
+	for i := range clients {
+		clients[i] = dialTestUDPClient(t, acceptor)
+	}
+
+	for round := 0; round < 2; round++ {
+		for i, client := range clients {
+			_, err := client.Write([]byte{byte('a' + i), byte('0' + round)})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for i, client := range clients {
+			want := string([]byte{byte('a' + i), byte('0' + round)})
+			echo := readTestDatagram(t, client)
+
+			if echo != want {
+				t.Fatalf("client %d received %q, want %q", i, echo, want)
+			}
+		}
+	}
+
+	if acceptor.Count() != len(clients) {
+		t.Fatalf("Count = %d, want one session per peer", acceptor.Count())
+	}
+
+	addresses := map[string]bool{}
+
+	for _, session := range acceptor.Sessions() {
+		addresses[session.GetSocket().GetRemoteAddress()] = true
+	}
+
+	for _, client := range clients {
+		if !addresses[client.LocalAddr().String()] {
+			t.Fatalf("no session for peer %s", client.LocalAddr())
+		}
+	}
+}
+
+func TestUDPAcceptorIdleTimeout(t *testing.T) {
+	sessions := make(chan *Session, 1)
+	acceptor := startTestUDPAcceptor(t, UDPAcceptorSettings{
+		IdleTimeout: 50 * time.Millisecond,
+		OnNewSession: func(acceptor *UDPAcceptor, session *Session) {
+			sessions <- session
+		},
+	})
+	client := dialTestUDPClient(t, acceptor)
+
+	_, err := client.Write([]byte("hello"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var session *Session
+
+	select {
+	case session = <-sessions:
+	case <-time.After(time.Second):
+		t.Fatal("no session was created")
+	}
+
+	waitDisconnect(t, session, ErrIdleTimeout)
+
+	ok := waitUntil(t, func() bool {
+		return acceptor.Count() == 0
+	})
+
+	if !ok {
+		t.Fatal("idle session was not removed")
+	}
+}
+
+func TestUDPAcceptorDropsOversizeDatagrams(t *testing.T) {
+	received := make(chan string, 4)
+	acceptor := startTestUDPAcceptor(t, UDPAcceptorSettings{
+		MaxDatagramSize: 16,
+		SessionSettings: SessionSettings{
+			OnRead: func(session *Session, data []byte, size int) {
+				received <- string(data)
+			},
+		},
+	})
+	client := dialTestUDPClient(t, acceptor)
+
+	for _, message := range []string{"this datagram is too large", "fits"} {
+		_, err := client.Write([]byte(message))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case data := <-received:
+		if data != "fits" {
+			t.Fatalf("received %q, want only the datagram that fits", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("datagram within the limit was not delivered")
+	}
+
+	if acceptor.Stats().Rejected != 1 {
+		t.Fatalf("Rejected = %d, want 1", acceptor.Stats().Rejected)
+	}
+}
+
+func TestUDPAcceptorMaxSessions(t *testing.T) {
+	rejected := make(chan RejectReason, 8)
+	settings := udpEchoSettings()
+	settings.MaxSessions = 1
+	settings.IdleTimeout = 100 * time.Millisecond
+	settings.OnReject = func(acceptor *UDPAcceptor, remoteAddr net.Addr, reason RejectReason) {
+		rejected <- reason
+	}
+
+	acceptor := startTestUDPAcceptor(t, settings)
+	first := dialTestUDPClient(t, acceptor)
+	second := dialTestUDPClient(t, acceptor)
+
+	first.Write([]byte("first"))
+	readTestDatagram(t, first)
+	second.Write([]byte("second"))
+
+	select {
+	case reason := <-rejected:
+		if reason != RejectMaxSessions {
+			t.Fatalf("rejected with %v, want %v", reason, RejectMaxSessions)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("datagram over the session limit was not rejected")
+	}
+
+	if acceptor.Count() != 1 {
+		t.Fatalf("Count = %d, want 1", acceptor.Count())
+	}
+
+	ok := waitUntil(t, func() bool {
+		return acceptor.Count() == 0
+	})
+
+	if !ok {
+		t.Fatal("first session did not expire")
+	}
+
+	second.Write([]byte("again"))
+
+	if readTestDatagram(t, second) != "again" {
+		t.Fatal("peer was not admitted after a session slot freed up")
+	}
+}
@@ -0,0 +1,254 @@
+package network
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxDatagramSize = 1472
+	maxDatagramSize        = 65507
+	defaultUDPIdleTimeout  = time.Second * 60
+	defaultUDPReceiveQueue = 128
+
+	// Datagram sessions read straight from the connection, so the session's
+	// buffered reader is never filled and only needs bufio's minimum size.
+	datagramReadBufferSize = 16
+)
+
+type datagramConn interface {
+	readDatagram(maxSize int) ([]byte, error)
+}
+
+// datagramFramer maps every datagram to exactly one packet, so no length
+// prefix is written or expected on the wire.
+type datagramFramer struct {
+	session *Session
+}
+
+func (framer *datagramFramer) ReadFrame(conn net.Conn, maxRecvBuffSize int) ([]byte, error) {
+	if buffered, ok := conn.(*bufferedConn); ok {
+		conn = buffered.Conn
+	}
+
+	packet, err := conn.(datagramConn).readDatagram(maxRecvBuffSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	framer.session.stats.addBytesIn(len(packet))
+
+	return packet, nil
+}
+
+func (framer *datagramFramer) BuildFrame(data []byte) []byte {
+	return data
+}
+
+type connDeadline struct {
+	mutex  sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+func (deadline *connDeadline) set(t time.Time) {
+	deadline.mutex.Lock()
+	defer deadline.mutex.Unlock()
+
+	if deadline.timer != nil && !deadline.timer.Stop() {
+		<-deadline.cancel
+	}
+
+	deadline.timer = nil
+
+	select {
+	case <-deadline.cancel:
+		deadline.cancel = make(chan struct{})
+	default:
+	}
+
+	if t.IsZero() {
+		return
+	}
+
+	duration := time.Until(t)
+
+	if duration <= 0 {
+		close(deadline.cancel)
+		return
+	}
+
+	cancel := deadline.cancel
+	deadline.timer = time.AfterFunc(duration, func() {
+		close(cancel)
+	})
+}
+
+func (deadline *connDeadline) wait() <-chan struct{} {
+	deadline.mutex.Lock()
+	defer deadline.mutex.Unlock()
+
+	return deadline.cancel
+}
+
+func newConnDeadline() *connDeadline {
+	return &connDeadline{
+		cancel: make(chan struct{}),
+	}
+}
+
+// udpConn is a virtual connection to one remote peer of a shared UDP socket.
+// Datagrams are delivered to it by the owning UDPAcceptor.
+type udpConn struct {
+	conn       *net.UDPConn
+	remoteAddr *net.UDPAddr
+	incoming   chan []byte
+	closed     chan struct{}
+	closeOnce  sync.Once
+	deadline   *connDeadline
+	onClose    func(conn *udpConn)
+}
+
+func (conn *udpConn) deliver(datagram []byte) bool {
+	select {
+	case <-conn.closed:
+		return false
+	default:
+	}
+
+	select {
+	case conn.incoming <- datagram:
+		return true
+	default:
+		return false
+	}
+}
+
+func (conn *udpConn) readDatagram(maxSize int) ([]byte, error) {
+	select {
+	case datagram := <-conn.incoming:
+		return datagram, nil
+	case <-conn.closed:
+		return nil, net.ErrClosed
+	case <-conn.deadline.wait():
+		return nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (conn *udpConn) Read(data []byte) (int, error) {
+	datagram, err := conn.readDatagram(len(data))
+
+	if err != nil {
+		return 0, err
+	}
+
+	return copy(data, datagram), nil
+}
+
+func (conn *udpConn) Write(data []byte) (int, error) {
+	select {
+	case <-conn.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	return conn.conn.WriteToUDP(data, conn.remoteAddr)
+}
+
+func (conn *udpConn) Close() error {
+	conn.closeOnce.Do(func() {
+		close(conn.closed)
+		conn.onClose(conn)
+	})
+
+	return nil
+}
+
+func (conn *udpConn) LocalAddr() net.Addr {
+	return conn.conn.LocalAddr()
+}
+
+func (conn *udpConn) RemoteAddr() net.Addr {
+	return conn.remoteAddr
+}
+
+func (conn *udpConn) SetDeadline(t time.Time) error {
+	return conn.SetReadDeadline(t)
+}
+
+func (conn *udpConn) SetReadDeadline(t time.Time) error {
+	conn.deadline.set(t)
+
+	return nil
+}
+
+func (conn *udpConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func newUDPConn(conn *net.UDPConn, remoteAddr *net.UDPAddr, queueSize int, onClose func(conn *udpConn)) *udpConn {
+	return &udpConn{
+		conn:       conn,
+		remoteAddr: remoteAddr,
+		incoming:   make(chan []byte, queueSize),
+		closed:     make(chan struct{}),
+		deadline:   newConnDeadline(),
+		onClose:    onClose,
+	}
+}
+
+// connectedUDPConn reads whole datagrams from a dialed UDP socket and
+// discards any that exceed the maximum size instead of truncating them.
+type connectedUDPConn struct {
+	*net.UDPConn
+}
+
+func (conn *connectedUDPConn) readDatagram(maxSize int) ([]byte, error) {
+	buffer := make([]byte, maxSize+1)
+
+	for {
+		size, err := conn.UDPConn.Read(buffer)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if size <= maxSize {
+			return buffer[:size:size], nil
+		}
+	}
+}
+
+func normalizeMaxDatagramSize(size int) int {
+	if size <= 0 {
+		return defaultMaxDatagramSize
+	}
+
+	if size > maxDatagramSize {
+		return maxDatagramSize
+	}
+
+	return size
+}
+
+func newDatagramSession(settings SessionSettings, conn net.Conn, maxSize int) *Session {
+	if settings.MaxRecvBuffSize <= 0 || settings.MaxRecvBuffSize > maxSize {
+		settings.MaxRecvBuffSize = maxSize
+	}
+
+	settings.Framer = nil
+	settings.ReadBufferSize = datagramReadBufferSize
+	settings.FlushInterval = 0
+	settings.MaxBatchSize = 1
+
+	session := NewSessionFromConn(settings, conn)
+	session.framer = &datagramFramer{session: session}
+	session.defaultBuildPacket = false
+	session.controlFrames = false
+	session.sendQueue.maxPacketSize = maxSize
+
+	return session
+}
@@ -0,0 +1,190 @@
+package network
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+type udpConnectorConnectedFunc func(connector *UDPConnector)
+type udpConnectorDisconnectedFunc func(connector *UDPConnector, session *Session, reason DisconnectReason)
+type udpConnectorErrorFunc func(connector *UDPConnector, err error)
+
+// UDPConnectorSettings configures a UDPConnector. The session sends each
+// packet as one datagram and receives one OnRead call per datagram.
+type UDPConnectorSettings struct {
+	OnConnected    udpConnectorConnectedFunc
+	OnDisconnected udpConnectorDisconnectedFunc
+	OnError        udpConnectorErrorFunc
+
+	SessionSettings SessionSettings
+	MaxDatagramSize int
+}
+
+type UDPConnector struct {
+	stats    connectorCounters
+	mutex    sync.Mutex
+	session  *Session
+	state    int32
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	onConnected    udpConnectorConnectedFunc
+	onDisconnected udpConnectorDisconnectedFunc
+	onError        udpConnectorErrorFunc
+
+	sessionSettings SessionSettings
+	maxDatagramSize int
+}
+
+func (connector *UDPConnector) SetUDPConnectorSettings(settings UDPConnectorSettings) {
+	connector.onConnected = settings.OnConnected
+	connector.onDisconnected = settings.OnDisconnected
+	connector.onError = settings.OnError
+	connector.sessionSettings = settings.SessionSettings
+	connector.maxDatagramSize = normalizeMaxDatagramSize(settings.MaxDatagramSize)
+
+	if connector.onConnected == nil {
+		connector.onConnected = func(connector *UDPConnector) {
+		}
+	}
+
+	if connector.onDisconnected == nil {
+		connector.onDisconnected = func(connector *UDPConnector, session *Session, reason DisconnectReason) {
+		}
+	}
+
+	if connector.onError == nil {
+		connector.onError = func(connector *UDPConnector, err error) {
+		}
+	}
+}
+
+func (connector *UDPConnector) Connect(host string, port int) bool {
+	return connector.DialNetwork("udp", ComposeAddressByHostAndPort(host, port))
+}
+
+// DialNetwork binds a UDP socket to the remote address on network "udp",
+// "udp4" or "udp6". No packets are exchanged, so success only means the
+// address was resolved.
+func (connector *UDPConnector) DialNetwork(network string, address string) bool {
+	connector.setState(ConnectorConnecting)
+	remoteAddr, err := net.ResolveUDPAddr(network, address)
+
+	if err == nil {
+		var conn *net.UDPConn
+		conn, err = net.DialUDP(network, nil, remoteAddr)
+
+		if err == nil {
+			connector.newSession(conn)
+			return !connector.isStopped()
+		}
+	}
+
+	connector.setState(ConnectorDisconnected)
+	connector.onError(connector, err)
+
+	return false
+}
+
+func (connector *UDPConnector) newSession(conn *net.UDPConn) {
+	session := newDatagramSession(connector.sessionSettings, &connectedUDPConn{UDPConn: conn}, connector.maxDatagramSize)
+	session.stats.parent = &connector.stats.trafficCounters
+	atomic.AddUint64(&connector.stats.connects, 1)
+
+	connector.mutex.Lock()
+	connector.session = session
+	connector.mutex.Unlock()
+
+	if connector.isStopped() {
+		session.Stop()
+		return
+	}
+
+	connector.setState(ConnectorConnected)
+	connector.onConnected(connector)
+}
+
+func (connector *UDPConnector) Start() {
+	go connector.run()
+}
+
+func (connector *UDPConnector) run() {
+	defer close(connector.done)
+
+	session := connector.GetSession()
+
+	if session == nil {
+		return
+	}
+
+	session.Start()
+	<-session.Done()
+	connector.setState(ConnectorDisconnected)
+	connector.onDisconnected(connector, session, session.GetDisconnectReason())
+}
+
+func (connector *UDPConnector) Done() <-chan struct{} {
+	return connector.done
+}
+
+func (connector *UDPConnector) Wait() {
+	<-connector.done
+}
+
+func (connector *UDPConnector) Stop() {
+	connector.stopOnce.Do(func() {
+		close(connector.stop)
+	})
+
+	connector.setState(ConnectorStopped)
+	session := connector.GetSession()
+
+	if session != nil {
+		session.Stop()
+	}
+}
+
+func (connector *UDPConnector) isStopped() bool {
+	select {
+	case <-connector.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (connector *UDPConnector) setState(state ConnectorState) {
+	if connector.isStopped() {
+		state = ConnectorStopped
+	}
+
+	atomic.StoreInt32(&connector.state, int32(state))
+}
+
+func (connector *UDPConnector) GetState() ConnectorState {
+	return ConnectorState(atomic.LoadInt32(&connector.state))
+}
+
+func (connector *UDPConnector) Stats() ConnectorStats {
+	return connector.stats.snapshot(connector.GetState())
+}
+
+func (connector *UDPConnector) GetSession() *Session {
+	connector.mutex.Lock()
+	defer connector.mutex.Unlock()
+
+	return connector.session
+}
+
+func NewUDPConnector(settings UDPConnectorSettings) *UDPConnector {
+	connector := &UDPConnector{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	connector.SetUDPConnectorSettings(settings)
+
+	return connector
+}